@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+
+	"k8s.io/api/core/v1"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// lastAppliedConfiguration serializes the desired object the way it is kept
+// in the last applied annotation, i.e. without the annotation itself
+func lastAppliedConfiguration(resourceData interface{}) (string, error) {
+	desired, err := toUnstructuredMap(resourceData)
+	if err != nil {
+		return "", err
+	}
+	pruneGeneratedFields(desired)
+	annotations, _, _ := unstructured.NestedStringMap(desired, "metadata", "annotations")
+	if _, ok := annotations[v1.LastAppliedConfigAnnotation]; ok {
+		delete(annotations, v1.LastAppliedConfigAnnotation)
+		err = unstructured.SetNestedStringMap(desired, annotations, "metadata", "annotations")
+		if err != nil {
+			return "", err
+		}
+	}
+	configuration, err := json.Marshal(desired)
+	if err != nil {
+		return "", err
+	}
+	return string(configuration), nil
+}
+
+// modifiedConfiguration serializes the desired object along with its last
+// applied annotation
+func modifiedConfiguration(resourceData interface{}) ([]byte, error) {
+	configuration, err := lastAppliedConfiguration(resourceData)
+	if err != nil {
+		return nil, err
+	}
+	desired := make(map[string]interface{})
+	err = json.Unmarshal([]byte(configuration), &desired)
+	if err != nil {
+		return nil, err
+	}
+	annotations, _, _ := unstructured.NestedStringMap(desired, "metadata", "annotations")
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[v1.LastAppliedConfigAnnotation] = configuration
+	err = unstructured.SetNestedStringMap(desired, annotations, "metadata", "annotations")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(desired)
+}
+
+// applyResource patches the live object with a three way merge between the
+// last applied configuration, the asset and the live object, so that fields
+// removed from the asset are removed from the cluster while fields set by
+// others are kept. It reports whether anything had to be patched. The patch
+// is only validated by the server when dryRun is set.
+func applyResource(kubeClient *KubeClient, apiVersion, kind, name, namespace string, resourceData interface{}, dryRun []string) (bool, error) {
+	modified, err := modifiedConfiguration(resourceData)
+	if err != nil {
+		return false, err
+	}
+	current, err := getGenericResource(kubeClient, apiVersion, kind, name, namespace)
+	if err != nil {
+		return false, err
+	}
+	patchType, patch, err := applyPatch(resourceData, modified, current)
+	if err != nil {
+		return false, err
+	}
+	if string(patch) == "{}" {
+		return false, nil
+	}
+	resource, err := kubeClient.resourceInterface(apiVersion, kind, namespace)
+	if err != nil {
+		return false, err
+	}
+	_, err = resource.Patch(name, patchType, patch, apiv1.PatchOptions{DryRun: dryRun})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// applyPatch computes the three way patch from the live object to the
+// modified configuration. The last applied configuration is stripped like
+// the modified one, so that null and generated fields recorded by an older
+// version never show up as changes.
+func applyPatch(resourceData interface{}, modified []byte, current *unstructured.Unstructured) (types.PatchType, []byte, error) {
+	currentJSON, err := current.MarshalJSON()
+	if err != nil {
+		return "", nil, err
+	}
+	original := []byte("{}")
+	lastApplied := current.GetAnnotations()[v1.LastAppliedConfigAnnotation]
+	if lastApplied != "" {
+		originalObject := make(map[string]interface{})
+		err = json.Unmarshal([]byte(lastApplied), &originalObject)
+		if err != nil {
+			return "", nil, err
+		}
+		pruneGeneratedFields(originalObject)
+		original, err = json.Marshal(originalObject)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	_, isUnstructured := resourceData.(*unstructured.Unstructured)
+	if isUnstructured {
+		// No go struct carries the patch strategies of this kind
+		patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, currentJSON)
+		return types.MergePatchType, patch, err
+	}
+	lookupPatchMeta, err := strategicpatch.NewPatchMetaFromStruct(resourceData)
+	if err != nil {
+		return "", nil, err
+	}
+	patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, currentJSON, lookupPatchMeta, true)
+	return types.StrategicMergePatchType, patch, err
+}
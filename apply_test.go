@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+func TestApplyUnchangedDeployment(t *testing.T) {
+	req := require.New(t)
+	replicas := int32(2)
+	labels := map[string]string{"name": "app"}
+	deployment := &appsv1.Deployment{
+		TypeMeta:   apiv1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: apiv1.ObjectMeta{Name: "app", Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &apiv1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: apiv1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{Name: "app", Image: "nginx:1.17"}},
+				},
+			},
+		},
+	}
+	modified, err := modifiedConfiguration(deployment)
+	req.NoError(err)
+
+	// The live object carries the fields set by the server, and the last
+	// applied configuration an older version recorded with null fields
+	oldConfiguration, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deployment)
+	req.NoError(err)
+	oldLastApplied, err := json.Marshal(oldConfiguration)
+	req.NoError(err)
+	req.Contains(string(oldLastApplied), `"creationTimestamp":null`)
+	live := deployment.DeepCopy()
+	live.Annotations = map[string]string{v1.LastAppliedConfigAnnotation: string(oldLastApplied)}
+	live.CreationTimestamp = apiv1.Now()
+	live.ResourceVersion = "42"
+	live.Spec.Strategy.Type = appsv1.RollingUpdateDeploymentStrategyType
+	live.Spec.Template.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+	live.Status.Replicas = replicas
+	liveMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	req.NoError(err)
+	current := &unstructured.Unstructured{Object: liveMap}
+
+	// The first apply only records the new last applied configuration
+	_, patch, err := applyPatch(deployment, modified, current)
+	req.NoError(err)
+	patchMap := make(map[string]interface{})
+	req.NoError(json.Unmarshal(patch, &patchMap))
+	req.NotContains(patchMap, "spec")
+	currentJSON, err := current.MarshalJSON()
+	req.NoError(err)
+	patchedJSON, err := strategicpatch.StrategicMergePatch(currentJSON, patch, &appsv1.Deployment{})
+	req.NoError(err)
+	current = &unstructured.Unstructured{}
+	req.NoError(current.UnmarshalJSON(patchedJSON))
+
+	// Applying the same deployment again is unchanged
+	_, patch, err = applyPatch(deployment, modified, current)
+	req.NoError(err)
+	req.Equal("{}", string(patch))
+}
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"strings"
 
 	"bytes"
 
 	"gopkg.in/yaml.v2"
+	appsv1 "k8s.io/api/apps/v1"
 	app "k8s.io/api/apps/v1beta1"
+	appsv1beta2 "k8s.io/api/apps/v1beta2"
 	v1batch "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	rbac "k8s.io/api/rbac/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
 )
 
@@ -22,66 +28,158 @@ func (err UnsupportedResource) Error() string {
 }
 
 type Asset struct {
+	APIVersion   string `yaml:"apiVersion"`
 	Kind         string `yaml:"kind"`
 	ResourceData interface{}
 	filename     string
+	index        int
 	data         []byte
 }
 
-func parseAsset(filename string, data []byte) (*Asset, error) {
+func parseAssets(filename string, data []byte) ([]*Asset, error) {
+	reader := kubeyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	assets := []*Asset{}
+	for index := 0; ; index++ {
+		document, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read asset %q, error: %s", filename, err.Error())
+		}
+		if isEmptyDocument(document) {
+			continue
+		}
+		asset, err := parseAsset(filename, index, document)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	return assets, nil
+}
+
+func parseAsset(filename string, index int, data []byte) (*Asset, error) {
 	asset := &Asset{}
 	asset.filename = filename
+	asset.index = index
 	asset.data = data
 	err := yaml.Unmarshal(data, asset)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse asset %q, error: %s", asset.filename, err.Error())
+		return nil, fmt.Errorf("unable to parse asset %s, error: %s", asset.Source(), err.Error())
 	}
 	asset.Kind = strings.ToLower(asset.Kind)
+	if asset.APIVersion == "" {
+		apiVersion, ok := legacyAPIVersions[asset.Kind]
+		if !ok {
+			return nil, UnsupportedResource(asset.Kind)
+		}
+		ErrPrintf(ColorYellow, "Asset %s has no apiVersion, using the deprecated %q\n", asset.Source(), apiVersion)
+		asset.APIVersion = apiVersion
+	}
 	err = asset.parseResource(data)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse asset %q, error: %s", asset.filename, err.Error())
+		return nil, fmt.Errorf("unable to parse asset %s, error: %s", asset.Source(), err.Error())
 	}
 	return asset, nil
 }
 
+// isEmptyDocument reports whether a yaml document has no content besides
+// comments and whitespaces, e.g. a trailing "---" at the end of a file
+func isEmptyDocument(document []byte) bool {
+	content := map[string]interface{}{}
+	err := yaml.Unmarshal(document, &content)
+	return err == nil && len(content) == 0
+}
+
+// legacyAPIVersions are the api versions assumed for assets written without
+// an apiVersion
+var legacyAPIVersions = map[string]string{
+	"pod":                   "v1",
+	"deployment":            "extensions/v1beta1",
+	"service":               "v1",
+	"job":                   "batch/v1",
+	"persistentvolumeclaim": "v1",
+	"configmap":             "v1",
+	"secret":                "v1",
+	"ingress":               "extensions/v1beta1",
+	"endpoints":             "v1",
+	"daemonset":             "extensions/v1beta1",
+	"serviceaccount":        "v1",
+	"role":                  "rbac.authorization.k8s.io/v1beta1",
+	"clusterrole":           "rbac.authorization.k8s.io/v1beta1",
+	"rolebinding":           "rbac.authorization.k8s.io/v1beta1",
+	"clusterrolebinding":    "rbac.authorization.k8s.io/v1beta1",
+	"statefulset":           "apps/v1beta1",
+}
+
+// resourceKey identifies a typed resource by its api version and lower case
+// kind, e.g. "apps/v1/deployment"
+func resourceKey(apiVersion, kind string) string {
+	return apiVersion + "/" + kind
+}
+
 func (asset *Asset) parseResource(data []byte) error {
 	buf := bytes.NewReader(data)
 	decoder := kubeyaml.NewYAMLOrJSONDecoder(buf, 1024)
-	switch asset.Kind {
-	case "pod":
+	switch resourceKey(asset.APIVersion, asset.Kind) {
+	case "v1/pod":
 		asset.ResourceData = &v1.Pod{}
-	case "deployment":
+	case "extensions/v1beta1/deployment":
 		asset.ResourceData = &v1beta1.Deployment{}
-	case "service":
+	case "apps/v1beta1/deployment":
+		asset.ResourceData = &app.Deployment{}
+	case "apps/v1beta2/deployment":
+		asset.ResourceData = &appsv1beta2.Deployment{}
+	case "apps/v1/deployment":
+		asset.ResourceData = &appsv1.Deployment{}
+	case "v1/service":
 		asset.ResourceData = &v1.Service{}
-	case "job":
+	case "batch/v1/job":
 		asset.ResourceData = &v1batch.Job{}
-	case "persistentvolumeclaim":
+	case "v1/persistentvolumeclaim":
 		asset.ResourceData = &v1.PersistentVolumeClaim{}
-	case "configmap":
+	case "v1/configmap":
 		asset.ResourceData = &v1.ConfigMap{}
-	case "secret":
+	case "v1/secret":
 		asset.ResourceData = &v1.Secret{}
-	case "ingress":
+	case "extensions/v1beta1/ingress":
 		asset.ResourceData = &v1beta1.Ingress{}
-	case "endpoints":
+	case "v1/endpoints":
 		asset.ResourceData = &v1.Endpoints{}
-	case "daemonset":
+	case "extensions/v1beta1/daemonset":
 		asset.ResourceData = &v1beta1.DaemonSet{}
-	case "serviceaccount":
+	case "apps/v1beta2/daemonset":
+		asset.ResourceData = &appsv1beta2.DaemonSet{}
+	case "apps/v1/daemonset":
+		asset.ResourceData = &appsv1.DaemonSet{}
+	case "v1/serviceaccount":
 		asset.ResourceData = &v1.ServiceAccount{}
-	case "role":
+	case "rbac.authorization.k8s.io/v1beta1/role":
 		asset.ResourceData = &rbac.Role{}
-	case "clusterrole":
+	case "rbac.authorization.k8s.io/v1beta1/clusterrole":
 		asset.ResourceData = &rbac.ClusterRole{}
-	case "rolebinding":
+	case "rbac.authorization.k8s.io/v1beta1/rolebinding":
 		asset.ResourceData = &rbac.RoleBinding{}
-	case "clusterrolebinding":
+	case "rbac.authorization.k8s.io/v1beta1/clusterrolebinding":
 		asset.ResourceData = &rbac.ClusterRoleBinding{}
-	case "statefulset":
+	case "rbac.authorization.k8s.io/v1/role":
+		asset.ResourceData = &rbacv1.Role{}
+	case "rbac.authorization.k8s.io/v1/clusterrole":
+		asset.ResourceData = &rbacv1.ClusterRole{}
+	case "rbac.authorization.k8s.io/v1/rolebinding":
+		asset.ResourceData = &rbacv1.RoleBinding{}
+	case "rbac.authorization.k8s.io/v1/clusterrolebinding":
+		asset.ResourceData = &rbacv1.ClusterRoleBinding{}
+	case "apps/v1beta1/statefulset":
 		asset.ResourceData = &app.StatefulSet{}
+	case "apps/v1beta2/statefulset":
+		asset.ResourceData = &appsv1beta2.StatefulSet{}
+	case "apps/v1/statefulset":
+		asset.ResourceData = &appsv1.StatefulSet{}
 	default:
-		return UnsupportedResource(asset.Kind)
+		// Kinds without a typed client are handled through the dynamic client
+		asset.ResourceData = &unstructured.Unstructured{}
 	}
 	err := decoder.Decode(asset.ResourceData)
 	if err != nil {
@@ -95,12 +193,45 @@ func (asset *Asset) UpdateNamespace(namespace string) {
 	objectMeta.SetNamespace(namespace)
 }
 
+// Source returns the file and the document position the asset was read from
+func (asset *Asset) Source() string {
+	return fmt.Sprintf("%q (document %d)", asset.filename, asset.index+1)
+}
+
+func (asset *Asset) AddLabels(labels map[string]string) {
+	objectMeta := asset.ResourceData.(Meta)
+	assetLabels := objectMeta.GetLabels()
+	if assetLabels == nil {
+		assetLabels = make(map[string]string)
+	}
+	for key, value := range labels {
+		assetLabels[key] = value
+	}
+	objectMeta.SetLabels(assetLabels)
+}
+
+func (asset *Asset) AddAnnotations(annotations map[string]string) {
+	objectMeta := asset.ResourceData.(Meta)
+	assetAnnotations := objectMeta.GetAnnotations()
+	if assetAnnotations == nil {
+		assetAnnotations = make(map[string]string)
+	}
+	for key, value := range annotations {
+		assetAnnotations[key] = value
+	}
+	objectMeta.SetAnnotations(assetAnnotations)
+}
+
 func (asset *Asset) Debug() {
-	fmt.Println(string(asset.data))
+	fmt.Fprintln(textOutput, string(asset.data))
 }
 
 type Meta interface {
 	GetName() string
 	GetNamespace() string
 	SetNamespace(namespace string)
+	GetLabels() map[string]string
+	SetLabels(labels map[string]string)
+	GetAnnotations() map[string]string
+	SetAnnotations(annotations map[string]string)
 }
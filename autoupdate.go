@@ -10,9 +10,12 @@ import (
 
 	"strconv"
 
+	appsv1 "k8s.io/api/apps/v1"
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	appsv1beta2 "k8s.io/api/apps/v1beta2"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 )
 
 type ContainerInfo struct {
@@ -22,20 +25,48 @@ type ContainerInfo struct {
 }
 
 type DeploymentInfo struct {
-	Deployment *v1beta1.Deployment
+	Deployment interface{}
+	Template   *corev1.PodTemplateSpec
 	Containers map[string]*ContainerInfo
 }
 
-func getDeployment(kubeClient *kubernetes.Clientset, name, namespace string) (*DeploymentInfo, error) {
-	deployment, err := kubeClient.Extensions().Deployments(namespace).Get(name, v1.GetOptions{})
-	if err != nil {
-		return nil, err
-	}
+func getDeployment(kubeClient *KubeClient, apiVersion, name, namespace string) (*DeploymentInfo, error) {
 	deploymentInfo := &DeploymentInfo{
-		Deployment: deployment,
 		Containers: make(map[string]*ContainerInfo),
 	}
-	for _, container := range deployment.Spec.Template.Spec.Containers {
+	switch resourceKey(apiVersion, "deployment") {
+	case "extensions/v1beta1/deployment":
+		deployment, err := kubeClient.Extensions().Deployments(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		deploymentInfo.Deployment = deployment
+		deploymentInfo.Template = &deployment.Spec.Template
+	case "apps/v1beta1/deployment":
+		deployment, err := kubeClient.AppsV1beta1().Deployments(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		deploymentInfo.Deployment = deployment
+		deploymentInfo.Template = &deployment.Spec.Template
+	case "apps/v1beta2/deployment":
+		deployment, err := kubeClient.AppsV1beta2().Deployments(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		deploymentInfo.Deployment = deployment
+		deploymentInfo.Template = &deployment.Spec.Template
+	case "apps/v1/deployment":
+		deployment, err := kubeClient.AppsV1().Deployments(namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		deploymentInfo.Deployment = deployment
+		deploymentInfo.Template = &deployment.Spec.Template
+	default:
+		return nil, UnsupportedResource(apiVersion + " deployment")
+	}
+	for _, container := range deploymentInfo.Template.Spec.Containers {
 		containerInfo := &ContainerInfo{
 			Name: container.Name,
 		}
@@ -49,12 +80,27 @@ func getDeployment(kubeClient *kubernetes.Clientset, name, namespace string) (*D
 	return deploymentInfo, nil
 }
 
+func updateDeployment(kubeClient *KubeClient, namespace string, deploymentInfo *DeploymentInfo) error {
+	var err error
+	switch deployment := deploymentInfo.Deployment.(type) {
+	case *v1beta1.Deployment:
+		_, err = kubeClient.Extensions().Deployments(namespace).Update(deployment)
+	case *appsv1beta1.Deployment:
+		_, err = kubeClient.AppsV1beta1().Deployments(namespace).Update(deployment)
+	case *appsv1beta2.Deployment:
+		_, err = kubeClient.AppsV1beta2().Deployments(namespace).Update(deployment)
+	case *appsv1.Deployment:
+		_, err = kubeClient.AppsV1().Deployments(namespace).Update(deployment)
+	}
+	return err
+}
+
 func readAutoupdateCredential(rootFolder string, credential *AutoUpdateCredential) (string, string, error) {
 	username := credential.Username
 	password := credential.Password
 	if password == "" {
 		passwordFile := translateFilePath(rootFolder, credential.PasswordFile)
-		buf, err := ioutil.ReadFile(passwordFile)
+		buf, err := readSecretFile(passwordFile)
 		if err != nil {
 			return "", "", err
 		}
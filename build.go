@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	contextHashLabel = "imladris.io/context-hash"
+	buildTagAuto     = "auto"
+	// buildTagGit gets a dirty suffix with the context hash on local changes
+	buildTagGit = "git"
+)
+
+type buildTagMode int
+
+const (
+	// skipBuildTags keeps e.g. "anduin/app:git" in build variables
+	skipBuildTags buildTagMode = iota
+	resolveBuildTags
+	tryBuildTags
+)
+
+type buildResult struct {
+	build *ProjectBuild
+	err   error
+}
+
+func isGeneratedTag(tag string) bool {
+	return tag == buildTagAuto || tag == buildTagGit
+}
+
+func usesGeneratedTag(build *ProjectBuild, pending []*ProjectBuild, varNames map[*ProjectBuild]string) bool {
+	for _, other := range pending {
+		if other == build || !isGeneratedTag(other.Tag) {
+			continue
+		}
+		reference := regexp.MustCompile(`\b` + regexp.QuoteMeta(varNames[other]) + `\b`)
+		for _, value := range build.BuildArgs {
+			if reference.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Project) resolveBuildTag(build *ProjectBuild) error {
+	switch p.buildTags {
+	case skipBuildTags:
+		return nil
+	case tryBuildTags:
+		err := p.generateBuildTag(build)
+		if err != nil {
+			Printf(ColorYellow, "Cannot generate the %s tag of %q, using %q: %s\n", build.Tag, build.Name, build.Name+":"+build.Tag, err.Error())
+		}
+		return nil
+	}
+	return p.generateBuildTag(build)
+}
+
+func (p *Project) generateBuildTag(build *ProjectBuild) error {
+	buildContext := translateFilePath(p.projectConfig.RootFolder, build.From)
+	options := p.buildOptions(build)
+	hash, err := buildContextHash(buildContext, options)
+	if err != nil {
+		return err
+	}
+	if build.Tag == buildTagAuto {
+		build.Tag = hash[:12]
+		return nil
+	}
+	commit, dirty, err := gitContextState(buildContext)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		// The context hash covers the build options
+		build.Tag = commit + "-dirty-" + hash[:12]
+		return nil
+	}
+	optionsHash, err := buildOptionsHash(options)
+	if err != nil {
+		return err
+	}
+	build.Tag = commit
+	if optionsHash != "" {
+		build.Tag += "-" + optionsHash[:8]
+	}
+	return nil
+}
+
+func gitContextState(folder string) (string, bool, error) {
+	commit, err := gitOutput(folder, "log", "-1", "--format=%H", "--", ".")
+	if err != nil {
+		return "", false, err
+	}
+	if len(commit) < 12 {
+		return "", false, fmt.Errorf("no git commit found for %q", folder)
+	}
+	status, err := gitOutput(folder, "status", "--porcelain", "--", ".")
+	if err != nil {
+		return "", false, err
+	}
+	return commit[:12], status != "", nil
+}
+
+func gitOutput(folder string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = folder
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s in %q failed: %s", args[0], folder, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func buildDependencies(builds []*ProjectBuild) map[*ProjectBuild][]*ProjectBuild {
+	images := make(map[string]*ProjectBuild)
+	for _, build := range builds {
+		images[build.Name+":"+build.Tag] = build
+	}
+	dependencies := make(map[*ProjectBuild][]*ProjectBuild)
+	for _, build := range builds {
+		seen := make(map[*ProjectBuild]struct{})
+		references := append([]string{}, build.CacheFrom...)
+		for _, value := range build.BuildArgs {
+			references = append(references, value)
+		}
+		for _, reference := range references {
+			dependency, ok := images[reference]
+			if !ok || dependency == build {
+				continue
+			}
+			_, duplicated := seen[dependency]
+			if duplicated {
+				continue
+			}
+			seen[dependency] = struct{}{}
+			dependencies[build] = append(dependencies[build], dependency)
+		}
+	}
+	return dependencies
+}
+
+func sortBuilds(builds []*ProjectBuild) ([]*ProjectBuild, error) {
+	dependencies := buildDependencies(builds)
+	sorted := []*ProjectBuild{}
+	done := make(map[*ProjectBuild]struct{})
+	for len(sorted) < len(builds) {
+		progressed := false
+		for _, build := range builds {
+			_, isDone := done[build]
+			if isDone || !buildDependenciesDone(dependencies[build], done) {
+				continue
+			}
+			done[build] = struct{}{}
+			sorted = append(sorted, build)
+			progressed = true
+		}
+		if !progressed {
+			cycle := []string{}
+			for _, build := range builds {
+				_, isDone := done[build]
+				if !isDone {
+					cycle = append(cycle, build.Name)
+				}
+			}
+			return nil, fmt.Errorf("build dependency cycle between %s", strings.Join(cycle, ", "))
+		}
+	}
+	return sorted, nil
+}
+
+func buildDependenciesDone(dependencies []*ProjectBuild, done map[*ProjectBuild]struct{}) bool {
+	for _, dependency := range dependencies {
+		_, ok := done[dependency]
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// build starts a build once the images it uses are built
+func (p *Project) build() error {
+	builds := p.projectConfig.Build
+	if len(builds) == 0 {
+		return nil
+	}
+	var client *DockerClient
+	if !p.dryRun {
+		var err error
+		client, err = p.dockerClient()
+		if err != nil {
+			return err
+		}
+	}
+	parallel := p.buildParallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	prefixed := parallel > 1 && len(builds) > 1
+	dependencies := buildDependencies(builds)
+	started := make(map[*ProjectBuild]struct{})
+	done := make(map[*ProjectBuild]struct{})
+	results := make(chan buildResult)
+	running := 0
+	var firstErr error
+	for {
+		for i, build := range builds {
+			if firstErr != nil || running >= parallel {
+				break
+			}
+			_, isStarted := started[build]
+			if isStarted || !buildDependenciesDone(dependencies[build], done) {
+				continue
+			}
+			started[build] = struct{}{}
+			running++
+			buildClient := client
+			if prefixed && client != nil {
+				buildClient = client.withPrefix(build.Name, PrefixColor(i))
+			}
+			go func(build *ProjectBuild, client *DockerClient) {
+				results <- buildResult{build: build, err: p.buildDockerImage(client, build)}
+			}(build, buildClient)
+		}
+		// readBuild rejected dependency cycles, nothing can be left waiting
+		if running == 0 {
+			return firstErr
+		}
+		result := <-results
+		running--
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+		done[result.build] = struct{}{}
+	}
+}
+
+func (p *Project) buildOptions(build *ProjectBuild) *BuildOptions {
+	options := &BuildOptions{
+		Tag:       build.Name + ":" + build.Tag,
+		BuildArgs: build.BuildArgs,
+		Target:    build.Target,
+		Labels:    make(map[string]string),
+		CacheFrom: build.CacheFrom,
+		Network:   build.Network,
+	}
+	for key, value := range build.Labels {
+		options.Labels[key] = value
+	}
+	if build.Dockerfile != "" {
+		options.Dockerfile = translateFilePath(p.projectConfig.RootFolder, build.Dockerfile)
+	}
+	return options
+}
+
+func (p *Project) buildDockerImage(client *DockerClient, build *ProjectBuild) error {
+	buildContext := translateFilePath(p.projectConfig.RootFolder, build.From)
+	tagName := build.Name + ":" + build.Tag
+	if p.dryRun {
+		Printf(ColorPurple, "Dry run, would build docker image %q in %q\n", tagName, buildContext)
+		if build.Push {
+			Printf(ColorPurple, "Dry run, would push docker image %q\n", tagName)
+		}
+		return nil
+	}
+	options := p.buildOptions(build)
+	start := time.Now()
+	hash, err := buildContextHash(buildContext, options)
+	if err != nil {
+		return err
+	}
+	options.Labels[contextHashLabel] = hash
+	if build.SkipUnchanged {
+		source, err := reusableImage(client, tagName, hash, build.Push)
+		if err != nil {
+			return err
+		}
+		if source != "" {
+			client.printf(ColorGreen, "Image %q was built from the same context, reusing the %s image\n", tagName, source)
+			reportEvent("image", tagName, "", "build", ResultUnchanged, start, nil)
+			if source == "pushed" || !build.Push {
+				return nil
+			}
+			start = time.Now()
+			err = client.Push(tagName, build.PushLatest)
+			reportEvent("image", tagName, "", "push", ResultPushed, start, err)
+			return err
+		}
+	}
+	err = client.BuildImage(buildContext, options)
+	reportEvent("image", tagName, "", "build", ResultBuilt, start, err)
+	if err != nil {
+		return err
+	}
+	if !build.Push {
+		return nil
+	}
+	start = time.Now()
+	err = client.Push(tagName, build.PushLatest)
+	reportEvent("image", tagName, "", "push", ResultPushed, start, err)
+	return err
+}
+
+// reusableImage returns "local", "pushed" or "" when the image has to be
+// built, the registry is only looked up for pushed builds
+func reusableImage(client *DockerClient, tagName, hash string, pushed bool) (string, error) {
+	image, err := client.InspectImage(tagName)
+	if err != nil && !isDockerNotFound(err) {
+		return "", err
+	}
+	if err == nil && image.Config.Labels[contextHashLabel] == hash {
+		return "local", nil
+	}
+	ids, err := client.ListImagesWithLabel(contextHashLabel, hash)
+	if err != nil {
+		return "", err
+	}
+	if len(ids) > 0 {
+		err = client.Tag(ids[0], tagName)
+		if err != nil {
+			return "", err
+		}
+		return "local", nil
+	}
+	if !pushed {
+		return "", nil
+	}
+	labels, err := client.RemoteImageLabels(tagName)
+	if isRegistryNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if labels[contextHashLabel] == hash {
+		return "pushed", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortBuilds(t *testing.T) {
+	req := require.New(t)
+	app := &ProjectBuild{
+		Name:      "anduin/app",
+		Tag:       "2.0",
+		BuildArgs: map[string]string{"BASE_IMAGE": "anduin/base:1.0"},
+	}
+	base := &ProjectBuild{Name: "anduin/base", Tag: "1.0"}
+	tools := &ProjectBuild{Name: "anduin/tools", Tag: "1.0", CacheFrom: []string{"anduin/tools:0.9"}}
+	sorted, err := sortBuilds([]*ProjectBuild{app, tools, base})
+	req.NoError(err)
+	req.Equal([]*ProjectBuild{tools, base, app}, sorted)
+
+	base.BuildArgs = map[string]string{"APP": "anduin/app:2.0"}
+	_, err = sortBuilds([]*ProjectBuild{app, tools, base})
+	req.Error(err)
+	req.Contains(err.Error(), "anduin/app, anduin/base")
+}
+
+// fakeDockerEngine records the builds, tags and pushes it receives, images
+// are listed with the hash label they were built with
+type fakeDockerEngine struct {
+	lock   sync.Mutex
+	images map[string]string
+	calls  []string
+}
+
+func (f *fakeDockerEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v"+maxDockerAPIVersion)
+	switch {
+	case path == "/version":
+		w.Write([]byte(`{"ApiVersion":"1.52","MinAPIVersion":"1.44"}`))
+	case path == "/images/json":
+		filters := map[string][]string{}
+		json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+		images := []map[string]string{}
+		for _, hash := range f.images {
+			if len(filters["label"]) == 1 && filters["label"][0] == contextHashLabel+"="+hash {
+				images = append(images, map[string]string{"Id": "sha256:" + hash})
+			}
+		}
+		json.NewEncoder(w).Encode(images)
+	case r.Method == "GET" && strings.HasSuffix(path, "/json"):
+		name := strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/json")
+		hash, ok := f.images[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"no such image"}`))
+			return
+		}
+		image := &dockerImage{ID: "sha256:" + hash}
+		image.Config.Labels = map[string]string{contextHashLabel: hash}
+		json.NewEncoder(w).Encode(image)
+	case path == "/build":
+		labels := make(map[string]string)
+		json.Unmarshal([]byte(r.URL.Query().Get("labels")), &labels)
+		f.images[r.URL.Query().Get("t")] = labels[contextHashLabel]
+		f.calls = append(f.calls, "build "+r.URL.Query().Get("t"))
+		w.Write([]byte(`{"stream":"Successfully built\n"}`))
+	case strings.HasSuffix(path, "/tag"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/tag")
+		alias := r.URL.Query().Get("repo") + ":" + r.URL.Query().Get("tag")
+		f.images[alias] = strings.TrimPrefix(id, "sha256:")
+		f.calls = append(f.calls, "tag "+alias)
+	default:
+		f.calls = append(f.calls, r.Method+" "+path)
+		w.Write([]byte(`{"status":"done"}`))
+	}
+}
+
+func TestBuildSkipUnchanged(t *testing.T) {
+	req := require.New(t)
+	folder, err := ioutil.TempDir("", "imladris-build")
+	req.NoError(err)
+	defer os.RemoveAll(folder)
+	for _, name := range []string{"base", "app"} {
+		req.NoError(os.MkdirAll(filepath.Join(folder, name), 0755))
+		req.NoError(ioutil.WriteFile(filepath.Join(folder, name, "Dockerfile"), []byte("FROM alpine\n"), 0644))
+	}
+
+	engine := &fakeDockerEngine{images: make(map[string]string)}
+	server := httptest.NewServer(engine)
+	defer server.Close()
+	os.Setenv("DOCKER_HOST", strings.Replace(server.URL, "http://", "tcp://", 1))
+	defer os.Unsetenv("DOCKER_HOST")
+
+	builds := []*ProjectBuild{
+		{Name: "anduin/base", Tag: "1.0", From: "base", SkipUnchanged: true},
+		{Name: "anduin/app", Tag: "2.0", From: "app", SkipUnchanged: true,
+			BuildArgs: map[string]string{"BASE_IMAGE": "anduin/base:1.0"}},
+	}
+	p := &Project{
+		projectConfig: &ProjectConfig{RootFolder: folder, Build: builds},
+		buildParallel: 2,
+	}
+	req.NoError(p.build())
+	req.Equal([]string{"build anduin/base:1.0", "build anduin/app:2.0"}, engine.calls)
+
+	// Nothing changed, both images are reused
+	engine.calls = nil
+	req.NoError(p.build())
+	req.Empty(engine.calls)
+
+	// Only the changed context is built again
+	req.NoError(ioutil.WriteFile(filepath.Join(folder, "app", "main.go"), []byte("package main\n"), 0644))
+	req.NoError(p.build())
+	req.Equal([]string{"build anduin/app:2.0"}, engine.calls)
+
+	// An image of the same context under another tag is tagged again
+	engine.calls = nil
+	builds[0].Tag = "1.1"
+	builds[1].BuildArgs = map[string]string{"BASE_IMAGE": "anduin/base:1.1"}
+	req.NoError(p.build())
+	req.Equal([]string{"tag anduin/base:1.1", "build anduin/app:2.0"}, engine.calls)
+}
+
+func TestRemoteImageLabels(t *testing.T) {
+	req := require.New(t)
+	var registryURL string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			user, password, _ := r.BasicAuth()
+			req.Equal("elrond", user)
+			req.Equal("mellon", password)
+			req.Equal("repository:anduin/app:pull", r.URL.Query().Get("scope"))
+			w.Write([]byte(`{"token":"vilya"}`))
+		case r.Header.Get("Authorization") != "Bearer vilya":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+registryURL+`/token",service="registry",scope="repository:anduin/app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/anduin/app/manifests/1.0":
+			w.Write([]byte(`{"mediaType":"` + manifestMediaType + `","config":{"digest":"sha256:abc"}}`))
+		case r.URL.Path == "/v2/anduin/app/blobs/sha256:abc":
+			w.Write([]byte(`{"config":{"Labels":{"` + contextHashLabel + `":"0123"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`))
+		}
+	}))
+	defer registry.Close()
+	registryURL = registry.URL
+	host := strings.TrimPrefix(registry.URL, "http://")
+	client := &DockerClient{auths: map[string]*registryAuth{
+		host: {Username: "elrond", Password: "mellon", ServerAddress: host},
+	}}
+
+	labels, err := client.RemoteImageLabels(host + "/anduin/app:1.0")
+	req.NoError(err)
+	req.Equal("0123", labels[contextHashLabel])
+
+	_, err = client.RemoteImageLabels(host + "/anduin/app:2.0")
+	req.Error(err)
+	req.True(isRegistryNotFound(err))
+
+	baseURL, repository := registryRepository("nginx:1.17")
+	req.Equal("https://"+dockerHubRegistry, baseURL)
+	req.Equal("library/nginx", repository)
+}
+
+func TestGitBuildTag(t *testing.T) {
+	req := require.New(t)
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	folder, err := ioutil.TempDir("", "imladris-git")
+	req.NoError(err)
+	defer os.RemoveAll(folder)
+	req.NoError(os.MkdirAll(filepath.Join(folder, "app"), 0755))
+	req.NoError(ioutil.WriteFile(filepath.Join(folder, "app", "Dockerfile"), []byte("FROM alpine\n"), 0644))
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=imladris", "-c", "user.email=imladris@example.com", "commit", "-q", "-m", "app"},
+	} {
+		_, err = gitOutput(folder, args...)
+		req.NoError(err)
+	}
+	commit, err := gitOutput(folder, "rev-parse", "HEAD")
+	req.NoError(err)
+
+	p := &Project{projectConfig: &ProjectConfig{RootFolder: folder}}
+	build := &ProjectBuild{Name: "anduin/app", Tag: buildTagGit, From: "app"}
+	req.NoError(p.generateBuildTag(build))
+	req.Equal(commit[:12], build.Tag)
+
+	req.NoError(ioutil.WriteFile(filepath.Join(folder, "app", "main.go"), []byte("package main\n"), 0644))
+	build.Tag = buildTagGit
+	req.NoError(p.generateBuildTag(build))
+	req.Regexp("^"+commit[:12]+"-dirty-[0-9a-f]{12}$", build.Tag)
+
+	// A clean tag changes with the build options
+	req.NoError(os.Remove(filepath.Join(folder, "app", "main.go")))
+	build = &ProjectBuild{Name: "anduin/app", Tag: buildTagGit, From: "app", BuildArgs: map[string]string{"VERSION": "1"}}
+	req.NoError(p.generateBuildTag(build))
+	req.Regexp("^"+commit[:12]+"-[0-9a-f]{8}$", build.Tag)
+
+	_, _, err = gitContextState(os.TempDir())
+	req.Error(err)
+
+	// Outside git, plan keeps the tag unresolved while up fails
+	outside, err := ioutil.TempDir("", "imladris-nogit")
+	req.NoError(err)
+	defer os.RemoveAll(outside)
+	p = &Project{projectConfig: &ProjectConfig{RootFolder: outside}, buildTags: tryBuildTags}
+	build = &ProjectBuild{Name: "anduin/app", Tag: buildTagGit, From: "."}
+	req.NoError(p.resolveBuildTag(build))
+	req.Equal(buildTagGit, build.Tag)
+	p.buildTags = resolveBuildTags
+	req.Error(p.resolveBuildTag(build))
+}
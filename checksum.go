@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// configChecksumAnnotation is set on pod templates to a hash of the
+	// configmaps and secrets the pods use, so that changing them rolls the pods
+	configChecksumAnnotation = "imladris.io/config-checksum"
+)
+
+// podTemplatePaths lists where the pod template lives in the workload kinds
+var podTemplatePaths = [][]string{
+	{"spec", "template"},
+	{"spec", "jobTemplate", "spec", "template"},
+}
+
+// addConfigChecksums annotates the pod template of every workload with a hash
+// of the data of the configmaps and secrets assets it references
+func (p *Project) addConfigChecksums() error {
+	configs := make(map[string]*Asset)
+	for _, asset := range p.allAssets() {
+		if asset.Kind == "configmap" || asset.Kind == "secret" {
+			configs[assetKey(asset.Kind, asset.ResourceData.(Meta).GetName())] = asset
+		}
+	}
+	if len(configs) == 0 {
+		return nil
+	}
+	for _, asset := range p.allAssets() {
+		err := addConfigChecksum(asset, configs)
+		if err != nil {
+			return fmt.Errorf("unable to add config checksum to asset %s: %s", asset.Source(), err.Error())
+		}
+	}
+	return nil
+}
+
+func addConfigChecksum(asset *Asset, configs map[string]*Asset) error {
+	object, err := toUnstructuredMap(asset.ResourceData)
+	if err != nil {
+		return err
+	}
+	for _, path := range podTemplatePaths {
+		template, found, err := unstructured.NestedMap(object, path...)
+		if err != nil || !found {
+			continue
+		}
+		checksum, err := configChecksum(podSpecReferences(map[string]interface{}{"spec": template["spec"]}), configs)
+		if err != nil {
+			return err
+		}
+		if checksum == "" {
+			return nil
+		}
+		annotationsPath := append(append([]string{}, path...), "metadata", "annotations")
+		annotations, _, _ := unstructured.NestedStringMap(object, annotationsPath...)
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[configChecksumAnnotation] = checksum
+		err = unstructured.SetNestedStringMap(object, annotations, annotationsPath...)
+		if err != nil {
+			return err
+		}
+		return setResourceData(asset, object)
+	}
+	return nil
+}
+
+// configChecksum hashes the data of the referenced configs found in the
+// project, in the order they are referenced
+func configChecksum(references []string, configs map[string]*Asset) (string, error) {
+	hash := sha256.New()
+	seen := make(map[string]struct{})
+	for _, reference := range references {
+		config, ok := configs[reference]
+		if !ok {
+			continue
+		}
+		_, duplicated := seen[reference]
+		if duplicated {
+			continue
+		}
+		seen[reference] = struct{}{}
+		object, err := toUnstructuredMap(config.ResourceData)
+		if err != nil {
+			return "", err
+		}
+		object = normalizeSecretData(object)
+		// Maps are marshalled with sorted keys, which keeps the hash stable
+		data, err := json.Marshal([]interface{}{reference, object["data"], object["binaryData"]})
+		if err != nil {
+			return "", err
+		}
+		hash.Write(data)
+	}
+	if len(seen) == 0 {
+		return "", nil
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// setResourceData replaces the content of an asset with a modified generic
+// representation of it
+func setResourceData(asset *Asset, object map[string]interface{}) error {
+	resource, ok := asset.ResourceData.(*unstructured.Unstructured)
+	if ok {
+		resource.Object = object
+		return nil
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(object, asset.ResourceData)
+}
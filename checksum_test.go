@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+)
+
+func TestConfigChecksum(t *testing.T) {
+	req := require.New(t)
+	config := &appConfig{}
+	project, err := readProject(nil, "test-assets/config-tests/checksum", config)
+	req.NoError(err)
+	req.Len(project.services, 2)
+
+	deployment, ok := project.services[0].ResourceData.(*appsv1.Deployment)
+	req.True(ok)
+	checksum := deployment.Spec.Template.Annotations[configChecksumAnnotation]
+	req.Len(checksum, 64)
+	req.Equal("busybox", deployment.Spec.Template.Spec.Containers[0].Image)
+
+	static, ok := project.services[1].ResourceData.(*appsv1.Deployment)
+	req.True(ok)
+	req.NotContains(static.Spec.Template.Annotations, configChecksumAnnotation)
+
+	// Changing the configuration changes the checksum
+	configMap, ok := project.resources[0].ResourceData.(*v1.ConfigMap)
+	req.True(ok)
+	configMap.Data["LOG_LEVEL"] = "debug"
+	req.NoError(project.addConfigChecksums())
+	req.NotEqual(checksum, deployment.Spec.Template.Annotations[configChecksumAnnotation])
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+func cmdApply(args []string, config *appConfig) {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	prune := flags.Bool("prune", false, "delete the objects removed from the project")
+	wait := flags.Bool("wait", false, "wait for the workloads to become ready before finalize scripts")
+	flags.Parse(args)
+	args = flags.Args()
+
+	clientset, err := loadKubernetesClient(config)
+	if err != nil {
+		finishReport(err)
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+	assetRoot := "."
+	if len(args) > 0 {
+		assetRoot = args[0]
+	}
+	config.buildTags = resolveBuildTags
+	project, err := readProject(clientset, assetRoot, config)
+	if err != nil {
+		finishReport(err)
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+	project.waitReady = *wait
+	err = project.Apply()
+	if err == nil && *prune {
+		err = project.Prune()
+	}
+	finishReport(err)
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+}
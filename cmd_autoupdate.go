@@ -5,6 +5,7 @@ import "os"
 func cmdAutoUpdate(args []string, config *appConfig) {
 	clientset, err := loadKubernetesClient(config)
 	if err != nil {
+		finishReport(err)
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
@@ -18,10 +19,12 @@ func cmdAutoUpdate(args []string, config *appConfig) {
 	}
 	project, err := readProject(clientset, assetRoot, config)
 	if err != nil {
+		finishReport(err)
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
 	err = project.AutoUpdate(newVersion)
+	finishReport(err)
 	if err != nil {
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
@@ -5,6 +5,7 @@ import "os"
 func cmdDebug(args []string, config *appConfig) {
 	clientset, err := loadKubernetesClient(config)
 	if err != nil {
+		finishReport(err)
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
@@ -12,10 +13,13 @@ func cmdDebug(args []string, config *appConfig) {
 	if len(args) > 0 {
 		assetRoot = args[0]
 	}
+	config.buildTags = resolveBuildTags
 	project, err := readProject(clientset, assetRoot, config)
 	if err != nil {
+		finishReport(err)
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
 	project.Debug()
+	finishReport(nil)
 }
@@ -5,6 +5,7 @@ import "os"
 func cmdDown(args []string, config *appConfig) {
 	clientset, err := loadKubernetesClient(config)
 	if err != nil {
+		finishReport(err)
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
@@ -12,12 +13,16 @@ func cmdDown(args []string, config *appConfig) {
 	if len(args) > 0 {
 		assetRoot = args[0]
 	}
+	// auto_clean removes the images under their generated tags
+	config.buildTags = tryBuildTags
 	project, err := readProject(clientset, assetRoot, config)
 	if err != nil {
+		finishReport(err)
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
 	err = project.Down()
+	finishReport(err)
 	if err != nil {
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
@@ -5,6 +5,7 @@ import "os"
 func cmdDownServices(args []string, config *appConfig) {
 	clientset, err := loadKubernetesClient(config)
 	if err != nil {
+		finishReport(err)
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
@@ -14,10 +15,12 @@ func cmdDownServices(args []string, config *appConfig) {
 	}
 	project, err := readProject(clientset, assetRoot, config)
 	if err != nil {
+		finishReport(err)
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
 	err = project.DownServices()
+	finishReport(err)
 	if err != nil {
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
@@ -1,22 +1,26 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
-	"os/exec"
-	"time"
+	"strings"
 
 	"k8s.io/api/core/v1"
 	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 )
 
 func cmdLog(args []string, config *appConfig) {
-	if len(args) < 1 {
-		fmt.Fprintf(os.Stderr, "USAGE: %s log pod-name\n", os.Args[0])
+	flags := flag.NewFlagSet("log", flag.ExitOnError)
+	selector := flags.String("l", "", "follow the pods matching this label selector")
+	projectFolder := flags.String("project", "", "follow the pods of the project in this folder, same as log <project-folder>")
+	flags.Parse(args)
+	args = flags.Args()
+
+	if len(args) < 1 && *selector == "" && *projectFolder == "" {
+		fmt.Fprintf(os.Stderr, "USAGE: %s log [-l selector] [pod-name|job/job-name|project-folder]\n", os.Args[0])
 		os.Exit(1)
 	}
-	podName := args[0]
 	namespace := "default"
 	if config.namespace != "" {
 		namespace = config.namespace
@@ -27,81 +31,77 @@ func cmdLog(args []string, config *appConfig) {
 		os.Exit(1)
 	}
 
-	tail := "-1"
-	for {
-		tailPodLog(clientset, podName, namespace, config.context, tail)
-
-		// Check pod exit Status
-		waitExit := 0
-	wait_exit:
-		for {
-			pod, err := clientset.Core().Pods(namespace).Get(podName, apiv1.GetOptions{})
-			if err != nil {
-				ErrPrintln(ColorRed, err)
-				os.Exit(1)
-			}
-
-			switch pod.Status.Phase {
-			case v1.PodSucceeded:
-				os.Exit(0)
-			case v1.PodFailed:
-				ErrPrintln(ColorRed, "Pod failed: ", pod.Status.ContainerStatuses[0].State.Terminated.Reason)
-				os.Exit(1)
-			case v1.PodRunning, v1.PodPending:
-				waitExit++
-				if waitExit <= 5 {
-					time.Sleep(time.Second)
-				} else {
-					containerStatus := pod.Status.ContainerStatuses[0]
-					fmt.Println(containerStatus)
-					if containerStatus.State.Terminated != nil {
-						os.Exit(int(containerStatus.State.Terminated.ExitCode))
-					}
-					ErrPrintln(ColorRed, "Log stream quited while pod still running")
-					ErrPrintln(ColorRed, "Restart log stream, some log lines may be lost")
-					waitExit = 0
-					tail = "1"
-					break wait_exit
-				}
-			default:
-				ErrPrintln(ColorRed, "Unknown pod phase")
-				os.Exit(1)
-			}
-		}
+	if *projectFolder != "" {
+		logProject(clientset, *projectFolder, config)
+		return
 	}
-
-}
-
-func tailPodLog(clientset *kubernetes.Clientset, podName, namespace, context, tail string) {
-	// Wait for pod running
-wait_running:
-	for {
-		pod, err := clientset.Core().Pods(namespace).Get(podName, apiv1.GetOptions{})
+	if *selector != "" {
+		err = newLogAggregator(clientset, namespace, []string{*selector}).run()
 		if err != nil {
 			ErrPrintln(ColorRed, err)
 			os.Exit(1)
 		}
-		switch pod.Status.Phase {
-		case v1.PodUnknown:
-			ErrPrintln(ColorRed, "Unknown pod phase")
+		return
+	}
+	if strings.HasPrefix(args[0], "job/") {
+		exitCode, err := followJobLog(clientset, namespace, strings.TrimPrefix(args[0], "job/"))
+		if err != nil {
+			ErrPrintln(ColorRed, err)
 			os.Exit(1)
-		case v1.PodPending:
-			time.Sleep(2 * time.Second)
-		default:
-			break wait_running
 		}
+		os.Exit(exitCode)
 	}
-	var cmd *exec.Cmd
-	if context == "" {
-		cmd = exec.Command("kubectl", "logs", "-f", "--tail", tail, podName, "--namespace", namespace)
-	} else {
-		cmd = exec.Command("kubectl", "logs", "-f", "--tail", tail, podName, "--namespace", namespace, "--context", context)
+	info, err := os.Stat(args[0])
+	if err == nil && info.IsDir() {
+		logProject(clientset, args[0], config)
+		return
 	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+	logPod(clientset, namespace, args[0])
+}
+
+func logProject(clientset *KubeClient, assetRoot string, config *appConfig) {
+	project, err := readProject(clientset, assetRoot, config)
 	if err != nil {
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
+	selectors, err := project.podSelectors()
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+	if len(selectors) == 0 {
+		ErrPrintln(ColorRed, "No pod template found in project")
+		os.Exit(1)
+	}
+	err = newLogAggregator(clientset, project.projectConfig.Namespace, selectors).run()
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+}
+
+func logPod(clientset *KubeClient, namespace, podName string) {
+	err := followPodLog(clientset, namespace, podName, "", func(line string) {
+		fmt.Println(line)
+	})
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+
+	// Check pod exit Status
+	pod, err := clientset.Core().Pods(namespace).Get(podName, apiv1.GetOptions{})
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+	exitCode, _ := podExitCode(pod)
+	if pod.Status.Phase == v1.PodFailed {
+		ErrPrintln(ColorRed, "Pod failed: ", pod.Status.Reason)
+		if exitCode == 0 {
+			exitCode = 1
+		}
+	}
+	os.Exit(exitCode)
 }
@@ -0,0 +1,27 @@
+package main
+
+import "os"
+
+func cmdPlan(args []string, config *appConfig) {
+	clientset, err := loadKubernetesClient(config)
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+	assetRoot := "."
+	if len(args) > 0 {
+		assetRoot = args[0]
+	}
+	// The plan compares images with generated tags when they can be generated
+	config.buildTags = tryBuildTags
+	project, err := readProject(clientset, assetRoot, config)
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+	err = project.Plan()
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+func cmdRender(args []string, config *appConfig) {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	outputFolder := flags.String("o", "", "write one file per asset to this folder instead of stdout")
+	flags.Parse(args)
+	args = flags.Args()
+
+	assetRoot := "."
+	if len(args) > 0 {
+		assetRoot = args[0]
+	}
+	config.buildTags = resolveBuildTags
+	// Rendering does not talk to the cluster
+	project, err := readProject(nil, assetRoot, config)
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+	if *outputFolder != "" {
+		err = project.RenderToFolder(*outputFolder)
+	} else {
+		err = project.Render(os.Stdout)
+	}
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+}
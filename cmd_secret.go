@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+func cmdSecret(args []string, config *appConfig) {
+	if len(args) < 1 || (args[0] != "keygen" && len(args) < 2) {
+		fmt.Fprintf(os.Stderr, "USAGE: %s secret encrypt|decrypt|edit <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s secret keygen\n", os.Args[0])
+		os.Exit(1)
+	}
+	if args[0] == "keygen" {
+		key, err := generateSecretKey()
+		if err != nil {
+			ErrPrintln(ColorRed, err)
+			os.Exit(1)
+		}
+		fmt.Println(key)
+		return
+	}
+	key, err := loadSecretKey()
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+	filename := args[1]
+	switch args[0] {
+	case "encrypt":
+		err = encryptFile(key, filename)
+	case "decrypt":
+		// The plaintext is only printed, never written next to the encrypted file
+		var plaintext []byte
+		plaintext, err = decryptFile(key, filename)
+		if err == nil {
+			os.Stdout.Write(plaintext)
+		}
+	case "edit":
+		err = editSecretFile(key, filename)
+	default:
+		err = fmt.Errorf("unknown secret command %q", args[0])
+	}
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+}
+
+func encryptFile(key []byte, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if isEncrypted(data) {
+		return fmt.Errorf("%q is already encrypted", filename)
+	}
+	encrypted, err := encryptData(key, data)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, encrypted, 0600)
+}
+
+func decryptFile(key []byte, filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decryptData(key, data)
+}
+
+// editSecretFile opens the plaintext of an encrypted file, or of a new file,
+// in $EDITOR and encrypts the result back in place
+func editSecretFile(key []byte, filename string) error {
+	plaintext := []byte{}
+	_, err := os.Stat(filename)
+	if err == nil {
+		plaintext, err = decryptFile(key, filename)
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile("", "imladris-secret-*"+filepath.Ext(filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(plaintext)
+	tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	// The file is passed as $1 so that its path is never parsed by the shell
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", tmpFile.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return err
+	}
+	edited, err := ioutil.ReadFile(tmpFile.Name())
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptData(key, edited)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, encrypted, 0600)
+}
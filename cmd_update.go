@@ -1,10 +1,19 @@
 package main
 
-import "os"
+import (
+	"flag"
+	"os"
+)
 
 func cmdUpdate(args []string, config *appConfig) {
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	wait := flags.Bool("wait", false, "wait for the workloads to become ready before finalize scripts")
+	flags.Parse(args)
+	args = flags.Args()
+
 	clientset, err := loadKubernetesClient(config)
 	if err != nil {
+		finishReport(err)
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
@@ -12,12 +21,16 @@ func cmdUpdate(args []string, config *appConfig) {
 	if len(args) > 0 {
 		assetRoot = args[0]
 	}
+	config.buildTags = resolveBuildTags
 	project, err := readProject(clientset, assetRoot, config)
 	if err != nil {
+		finishReport(err)
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
 	}
+	project.waitReady = *wait
 	err = project.Update()
+	finishReport(err)
 	if err != nil {
 		ErrPrintln(ColorRed, err)
 		os.Exit(1)
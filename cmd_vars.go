@@ -0,0 +1,17 @@
+package main
+
+import "os"
+
+func cmdVars(args []string, config *appConfig) {
+	assetRoot := "."
+	if len(args) > 0 {
+		assetRoot = args[0]
+	}
+	// Variables are resolved without the cluster
+	project, err := readProject(nil, assetRoot, config)
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		os.Exit(1)
+	}
+	project.PrintVariables()
+}
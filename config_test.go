@@ -5,9 +5,13 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	appsv1beta2 "k8s.io/api/apps/v1beta2"
 	v1batch "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func TestDefaultVariables(t *testing.T) {
@@ -117,6 +121,53 @@ func TestSimpleConfigBuild(t *testing.T) {
 	req.Equal(projectConfig.Variables["test_image_2"], "anduin/test2:3.1.4")
 }
 
+func TestConfigBuildOptions(t *testing.T) {
+	req := require.New(t)
+	config := &appConfig{
+		variables: variableMap{"version": "2.0.2"},
+	}
+	project, err := readProject(nil, "test-assets/config-tests/build-options", config)
+	req.NoError(err)
+	req.Len(project.projectConfig.Build, 2)
+	build := project.projectConfig.Build[1]
+	req.Equal("docker/app.Dockerfile", build.Dockerfile)
+	req.Equal("runtime", build.Target)
+	req.Equal("host", build.Network)
+	req.Equal(map[string]string{
+		"VERSION":    "2.0.2",
+		"BASE_IMAGE": "anduin/base:1.0",
+		"STATIC":     "plain",
+	}, build.BuildArgs)
+	req.Equal(map[string]string{"org.opencontainers.image.title": "app"}, build.Labels)
+	req.Equal([]string{"anduin/app:latest"}, build.CacheFrom)
+}
+
+func TestConfigAutoTags(t *testing.T) {
+	req := require.New(t)
+	config := &appConfig{buildTags: resolveBuildTags}
+	project, err := readProject(nil, "test-assets/config-tests/auto-tags", config)
+	req.NoError(err)
+	app := project.projectConfig.Build[0]
+	base := project.projectConfig.Build[1]
+	req.Regexp("^[0-9a-f]{12}$", base.Tag)
+	req.Regexp("^[0-9a-f]{12}$", app.Tag)
+	variables := project.projectConfig.Variables
+	req.Equal("anduin/base:"+base.Tag, variables["build_var_anduin_base"])
+	req.Equal("anduin/app:"+app.Tag, variables["build_var_anduin_app"])
+	req.Equal("anduin/base:"+base.Tag, app.BuildArgs["BASE_IMAGE"])
+
+	again, err := readProject(nil, "test-assets/config-tests/auto-tags", config)
+	req.NoError(err)
+	req.Equal(app.Tag, again.projectConfig.Build[0].Tag)
+	req.Equal(base.Tag, again.projectConfig.Build[1].Tag)
+
+	// Commands that do not use images leave the tags unresolved
+	skipped, err := readProject(nil, "test-assets/config-tests/auto-tags", &appConfig{})
+	req.NoError(err)
+	req.Equal(buildTagAuto, skipped.projectConfig.Build[0].Tag)
+	req.Equal("anduin/base:auto", skipped.projectConfig.Build[0].BuildArgs["BASE_IMAGE"])
+}
+
 func TestConfigNotSimpleLocal(t *testing.T) {
 	req := require.New(t)
 	config := &appConfig{
@@ -211,3 +262,184 @@ func checkNotSimpleServiceRemote(req *require.Assertions, service *Asset) {
 	req.True(ok)
 	req.Equal("remote", srv.Name)
 }
+
+func TestConfigMultiDocument(t *testing.T) {
+	req := require.New(t)
+	config := &appConfig{}
+	appRoot := "test-assets/config-tests/multi-document"
+	project, err := readProject(nil, appRoot, config)
+	req.NoError(err)
+	req.NotNil(project)
+	req.Len(project.services, 3)
+
+	req.Equal("deployment", project.services[0].Kind)
+	req.Equal(0, project.services[0].index)
+	deployment, ok := project.services[0].ResourceData.(*v1beta1.Deployment)
+	req.True(ok)
+	req.Equal("app", deployment.Name)
+	req.Equal("default", deployment.Namespace)
+
+	req.Equal("service", project.services[1].Kind)
+	req.Equal(1, project.services[1].index)
+	srv, ok := project.services[1].ResourceData.(*v1.Service)
+	req.True(ok)
+	req.Equal("app", srv.Name)
+	req.Equal("default", srv.Namespace)
+
+	req.Equal("configmap", project.services[2].Kind)
+	req.Equal(3, project.services[2].index)
+	configMap, ok := project.services[2].ResourceData.(*v1.ConfigMap)
+	req.True(ok)
+	req.Equal("value", configMap.Data["key"])
+	for _, asset := range project.services {
+		req.Equal("test-assets/config-tests/multi-document/services/app.yml", asset.filename)
+		labels := asset.ResourceData.(Meta).GetLabels()
+		req.Equal("multi-document", labels[projectLabel])
+		req.Equal("services-app.yml", labels[assetLabel])
+	}
+}
+
+func TestConfigGenericResource(t *testing.T) {
+	req := require.New(t)
+	config := &appConfig{}
+	appRoot := "test-assets/config-tests/generic"
+	_, err := readProject(nil, appRoot, config)
+	req.Error(err)
+	req.Contains(err.Error(), "unsupported resource: unknown")
+
+	project := &Project{
+		projectConfig: &ProjectConfig{
+			Namespace: "anduin",
+		},
+	}
+	assets, err := project.readAsset("test-assets/config-tests/generic/resources/cronjob.yml")
+	req.NoError(err)
+	req.Len(assets, 1)
+	req.Equal("batch/v1beta1", assets[0].APIVersion)
+	req.Equal("cronjob", assets[0].Kind)
+	cronJob, ok := assets[0].ResourceData.(*unstructured.Unstructured)
+	req.True(ok)
+	req.Equal("cleanup", cronJob.GetName())
+	req.Equal("anduin", cronJob.GetNamespace())
+	images, err := getResourceImages(assets[0].Kind, assets[0].ResourceData)
+	req.NoError(err)
+	req.Equal([]string{"anduin/cleanup:1.0.0"}, images)
+}
+
+func TestConfigAPIVersions(t *testing.T) {
+	req := require.New(t)
+	config := &appConfig{}
+	appRoot := "test-assets/config-tests/api-versions"
+	project, err := readProject(nil, appRoot, config)
+	req.NoError(err)
+	req.Len(project.services, 4)
+
+	req.Equal("apps/v1", project.services[0].APIVersion)
+	req.Equal("deployment", project.services[0].Kind)
+	deployment, ok := project.services[0].ResourceData.(*appsv1.Deployment)
+	req.True(ok)
+	req.Equal("app", deployment.Name)
+	images, err := getResourceImages(project.services[0].Kind, project.services[0].ResourceData)
+	req.NoError(err)
+	req.Equal([]string{"anduin/app:1.0.0"}, images)
+
+	req.Equal("networking.k8s.io/v1", project.services[1].APIVersion)
+	req.Equal("ingress", project.services[1].Kind)
+	ingress, ok := project.services[1].ResourceData.(*unstructured.Unstructured)
+	req.True(ok)
+	req.Equal("app", ingress.GetName())
+	req.Equal("default", ingress.GetNamespace())
+
+	legacy, ok := project.services[2].ResourceData.(*appsv1beta2.Deployment)
+	req.True(ok)
+	req.Equal("legacy", legacy.Name)
+	images, err = getResourceImages(project.services[2].Kind, project.services[2].ResourceData)
+	req.NoError(err)
+	req.Equal([]string{"anduin/legacy:0.9.0"}, images)
+
+	_, ok = project.services[3].ResourceData.(*rbacv1.Role)
+	req.True(ok)
+}
+
+func TestAssetWithoutAPIVersion(t *testing.T) {
+	req := require.New(t)
+	assets, err := parseAssets("service.yml", []byte("kind: Service\nmetadata:\n  name: app\n---\nkind: Deployment\nmetadata:\n  name: app\n"))
+	req.NoError(err)
+	req.Len(assets, 2)
+	req.Equal("v1", assets[0].APIVersion)
+	req.IsType(&v1.Service{}, assets[0].ResourceData)
+	req.Equal("extensions/v1beta1", assets[1].APIVersion)
+	req.IsType(&v1beta1.Deployment{}, assets[1].ResourceData)
+
+	_, err = parseAssets("unknown.yml", []byte("kind: Unknown\nmetadata:\n  name: app\n"))
+	req.Error(err)
+	req.Contains(err.Error(), "unsupported resource: unknown")
+}
+
+func TestConfigEnvironments(t *testing.T) {
+	req := require.New(t)
+	appRoot := "test-assets/config-tests/environments"
+	project, err := readProject(nil, appRoot, &appConfig{})
+	req.NoError(err)
+	req.Equal("dev", project.projectConfig.Namespace)
+	req.Len(project.services, 2)
+	req.Equal("debug", project.services[0].ResourceData.(*v1.ConfigMap).Data["LOG_LEVEL"])
+
+	project, err = readProject(nil, appRoot, &appConfig{environment: "staging"})
+	req.NoError(err)
+	req.Equal("staging", project.projectConfig.Namespace)
+	req.Equal("staging", project.projectConfig.Variables["app_var_env"])
+	req.Len(project.services, 2)
+	app := project.services[0].ResourceData.(*v1.ConfigMap)
+	req.Equal("app", app.Name)
+	req.Equal("staging", app.Namespace)
+	req.Equal("info", app.Data["LOG_LEVEL"])
+	req.Equal("seed", project.services[1].ResourceData.(Meta).GetName())
+
+	project, err = readProject(nil, appRoot, &appConfig{
+		environment: "staging",
+		namespace:   "anduin",
+		variables:   variableMap{"log_level": "warn"},
+	})
+	req.NoError(err)
+	req.Equal("anduin", project.projectConfig.Namespace)
+	req.Equal("warn", project.services[0].ResourceData.(*v1.ConfigMap).Data["LOG_LEVEL"])
+
+	project, err = readProject(nil, appRoot, &appConfig{environment: "prod"})
+	req.NoError(err)
+	req.Equal("dev", project.projectConfig.Namespace)
+
+	_, err = readProject(nil, appRoot, &appConfig{environment: "qa"})
+	req.Error(err)
+	req.Contains(err.Error(), "available environments: prod, staging")
+}
+
+func TestConfigVariableLayers(t *testing.T) {
+	req := require.New(t)
+	os.Setenv(variableEnvPrefix+"color", "red")
+	defer os.Unsetenv(variableEnvPrefix + "color")
+	config := &appConfig{
+		variables:     variableMap{"region": "rhovanion"},
+		variableFiles: stringList{"test-assets/config-tests/variables/vars/override.yml"},
+	}
+	project, err := readProject(nil, "test-assets/config-tests/variables", config)
+	req.NoError(err)
+	variables := project.projectConfig.Variables
+	req.Equal("rhovanion", variables["region"])
+	req.Equal("-variable flag", project.variableSources["region"])
+	req.Equal("backend", variables["tier"])
+	req.Equal("file test-assets/config-tests/variables/vars/common.yml", project.variableSources["tier"])
+	req.Equal("3", variables["replicas"])
+	req.Equal("red", variables["color"])
+	req.Equal("environment variable IMLADRIS_VAR_color", project.variableSources["color"])
+	req.Equal("builtin", project.variableSources["app_var_namespace"])
+}
+
+func TestVariableFlag(t *testing.T) {
+	req := require.New(t)
+	variables := make(variableMap)
+	req.NoError(variables.Set("key=value=with=equals"))
+	req.Equal("value=with=equals", variables["key"])
+	req.Error(variables.Set("novalue"))
+	req.Error(variables.Set("=value"))
+}
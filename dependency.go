@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// dependsOnAnnotation lists the assets, as comma separated "kind/name",
+	// that must be deployed before the annotated one
+	dependsOnAnnotation = "imladris.io/depends-on"
+)
+
+// dependencyGraph orders the assets of one deployment phase
+type dependencyGraph struct {
+	assets       []*Asset
+	order        map[*Asset]int
+	dependencies map[*Asset][]*Asset
+	dependents   map[*Asset][]*Asset
+}
+
+type assetResult struct {
+	asset *Asset
+	err   error
+}
+
+func assetKey(kind, name string) string {
+	return strings.ToLower(kind) + "/" + name
+}
+
+// buildDependencyGraph links the assets through their depends-on annotation
+// and the configmaps, secrets, persistent volume claims and service accounts
+// their pod spec refers to. Dependencies on assets from an earlier phase,
+// listed in deployed, are already satisfied.
+func buildDependencyGraph(assets []*Asset, deployed map[string]struct{}) (*dependencyGraph, error) {
+	g := &dependencyGraph{
+		assets:       assets,
+		order:        make(map[*Asset]int),
+		dependencies: make(map[*Asset][]*Asset),
+		dependents:   make(map[*Asset][]*Asset),
+	}
+	byKey := make(map[string]*Asset)
+	for i, asset := range assets {
+		g.order[asset] = i
+		byKey[assetKey(asset.Kind, asset.ResourceData.(Meta).GetName())] = asset
+	}
+	for _, asset := range assets {
+		explicit, inferred, err := assetDependencies(asset)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[*Asset]struct{})
+		for _, key := range append(explicit, inferred...) {
+			dependency, ok := byKey[key]
+			if !ok {
+				continue
+			}
+			_, duplicated := seen[dependency]
+			if dependency == asset || duplicated {
+				continue
+			}
+			seen[dependency] = struct{}{}
+			g.dependencies[asset] = append(g.dependencies[asset], dependency)
+			g.dependents[dependency] = append(g.dependents[dependency], asset)
+		}
+		for _, key := range explicit {
+			_, inPhase := byKey[key]
+			_, wasDeployed := deployed[key]
+			if !inPhase && !wasDeployed {
+				return nil, fmt.Errorf("asset %s depends on %q which is not deployed before it", asset.Source(), key)
+			}
+		}
+	}
+	err := g.checkCycles()
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func assetDependencies(asset *Asset) ([]string, []string, error) {
+	explicit := []string{}
+	annotations := asset.ResourceData.(Meta).GetAnnotations()
+	for _, dependency := range strings.Split(annotations[dependsOnAnnotation], ",") {
+		dependency = strings.TrimSpace(dependency)
+		if dependency == "" {
+			continue
+		}
+		pieces := strings.SplitN(dependency, "/", 2)
+		if len(pieces) != 2 {
+			return nil, nil, fmt.Errorf("invalid dependency %q in asset %s, expected kind/name", dependency, asset.Source())
+		}
+		explicit = append(explicit, assetKey(pieces[0], pieces[1]))
+	}
+	object, err := toUnstructuredMap(asset.ResourceData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return explicit, podSpecReferences(object), nil
+}
+
+// checkCycles runs a topological sort and reports the assets left over
+func (g *dependencyGraph) checkCycles() error {
+	remaining := make(map[*Asset]int)
+	ready := []*Asset{}
+	for _, asset := range g.assets {
+		remaining[asset] = len(g.dependencies[asset])
+		if remaining[asset] == 0 {
+			ready = append(ready, asset)
+		}
+	}
+	sorted := 0
+	for len(ready) > 0 {
+		asset := ready[0]
+		ready = ready[1:]
+		sorted++
+		for _, dependent := range g.dependents[asset] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if sorted == len(g.assets) {
+		return nil
+	}
+	cycle := []string{}
+	for _, asset := range g.assets {
+		if remaining[asset] > 0 {
+			cycle = append(cycle, assetKey(asset.Kind, asset.ResourceData.(Meta).GetName()))
+		}
+	}
+	return fmt.Errorf("dependency cycle between %s", strings.Join(cycle, ", "))
+}
+
+// run calls deployAsset on every asset once its dependencies are deployed,
+// with at most parallel calls at a time. Assets that are ready together are
+// started in their glob order. No asset is started after a failure.
+func (g *dependencyGraph) run(parallel int, deployAsset func(asset *Asset) error) error {
+	if parallel < 1 {
+		parallel = 1
+	}
+	remaining := make(map[*Asset]int)
+	ready := []*Asset{}
+	for _, asset := range g.assets {
+		remaining[asset] = len(g.dependencies[asset])
+		if remaining[asset] == 0 {
+			ready = append(ready, asset)
+		}
+	}
+	results := make(chan assetResult)
+	running := 0
+	var firstErr error
+	for {
+		for firstErr == nil && len(ready) > 0 && running < parallel {
+			asset := ready[0]
+			ready = ready[1:]
+			running++
+			go func(asset *Asset) {
+				results <- assetResult{asset: asset, err: deployAsset(asset)}
+			}(asset)
+		}
+		if running == 0 {
+			return firstErr
+		}
+		result := <-results
+		running--
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+		for _, dependent := range g.dependents[result.asset] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+		sort.SliceStable(ready, func(i, j int) bool {
+			return g.order[ready[i]] < g.order[ready[j]]
+		})
+	}
+}
+
+// podSpecReferences lists, as "kind/name", the configmaps, secrets,
+// persistent volume claims and service accounts used by the pod spec of a
+// workload
+func podSpecReferences(object map[string]interface{}) []string {
+	references := []string{}
+	for _, path := range podSpecPaths {
+		podSpec, found, err := unstructured.NestedMap(object, path...)
+		if err != nil || !found {
+			continue
+		}
+		_, hasContainers := podSpec["containers"]
+		if !hasContainers {
+			continue
+		}
+		for _, field := range []string{"serviceAccountName", "serviceAccount"} {
+			name, _, _ := unstructured.NestedString(podSpec, field)
+			if name != "" {
+				references = append(references, assetKey("serviceaccount", name))
+			}
+		}
+		for _, pullSecret := range nestedMaps(podSpec, "imagePullSecrets") {
+			references = appendReference(references, "secret", pullSecret, "name")
+		}
+		for _, volume := range nestedMaps(podSpec, "volumes") {
+			references = appendReference(references, "configmap", volume, "configMap", "name")
+			references = appendReference(references, "secret", volume, "secret", "secretName")
+			references = appendReference(references, "persistentvolumeclaim", volume, "persistentVolumeClaim", "claimName")
+			for _, source := range nestedMaps(volume, "projected", "sources") {
+				references = appendReference(references, "configmap", source, "configMap", "name")
+				references = appendReference(references, "secret", source, "secret", "name")
+			}
+		}
+		containers := append(nestedMaps(podSpec, "initContainers"), nestedMaps(podSpec, "containers")...)
+		for _, container := range containers {
+			for _, envFrom := range nestedMaps(container, "envFrom") {
+				references = appendReference(references, "configmap", envFrom, "configMapRef", "name")
+				references = appendReference(references, "secret", envFrom, "secretRef", "name")
+			}
+			for _, env := range nestedMaps(container, "env") {
+				references = appendReference(references, "configmap", env, "valueFrom", "configMapKeyRef", "name")
+				references = appendReference(references, "secret", env, "valueFrom", "secretKeyRef", "name")
+			}
+		}
+	}
+	return references
+}
+
+func appendReference(references []string, kind string, object map[string]interface{}, fields ...string) []string {
+	name, _, _ := unstructured.NestedString(object, fields...)
+	if name == "" {
+		return references
+	}
+	return append(references, assetKey(kind, name))
+}
+
+func nestedMaps(object map[string]interface{}, fields ...string) []map[string]interface{} {
+	items, _, _ := unstructured.NestedSlice(object, fields...)
+	maps := []map[string]interface{}{}
+	for _, item := range items {
+		itemMap, ok := item.(map[string]interface{})
+		if ok {
+			maps = append(maps, itemMap)
+		}
+	}
+	return maps
+}
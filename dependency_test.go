@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const dependencyTestAssets = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    imladris.io/depends-on: service/db
+spec:
+  selector:
+    matchLabels:
+      name: app
+  template:
+    metadata:
+      labels:
+        name: app
+    spec:
+      serviceAccountName: app
+      containers:
+        - name: app
+          image: app
+          envFrom:
+            - configMapRef:
+                name: app
+          env:
+            - name: PASSWORD
+              valueFrom:
+                secretKeyRef:
+                  name: app
+                  key: password
+      volumes:
+        - name: data
+          persistentVolumeClaim:
+            claimName: data
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: db
+spec:
+  ports:
+    - port: 5432
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: app
+`
+
+func TestDependencyGraphOrder(t *testing.T) {
+	req := require.New(t)
+	assets, err := parseAssets("app.yml", []byte(dependencyTestAssets))
+	req.NoError(err)
+	graph, err := buildDependencyGraph(assets, map[string]struct{}{})
+	req.NoError(err)
+	dependencies := []string{}
+	for _, dependency := range graph.dependencies[assets[0]] {
+		dependencies = append(dependencies, assetKey(dependency.Kind, dependency.ResourceData.(Meta).GetName()))
+	}
+	req.ElementsMatch([]string{"service/db", "configmap/app", "secret/app", "persistentvolumeclaim/data", "serviceaccount/app"}, dependencies)
+
+	for _, parallel := range []int{1, 3} {
+		lock := sync.Mutex{}
+		deployed := []string{}
+		err = graph.run(parallel, func(asset *Asset) error {
+			lock.Lock()
+			defer lock.Unlock()
+			deployed = append(deployed, assetKey(asset.Kind, asset.ResourceData.(Meta).GetName()))
+			return nil
+		})
+		req.NoError(err)
+		req.Len(deployed, 6)
+		req.Equal("deployment/app", deployed[5])
+	}
+}
+
+func TestDependencyGraphErrors(t *testing.T) {
+	req := require.New(t)
+	assets, err := parseAssets("cycle.yml", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  annotations:
+    imladris.io/depends-on: configmap/b
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+  annotations:
+    imladris.io/depends-on: configmap/a
+`))
+	req.NoError(err)
+	_, err = buildDependencyGraph(assets, map[string]struct{}{})
+	req.Error(err)
+	req.Contains(err.Error(), "dependency cycle")
+
+	_, err = buildDependencyGraph(assets[:1], map[string]struct{}{})
+	req.Error(err)
+	_, err = buildDependencyGraph(assets[:1], map[string]struct{}{"configmap/b": {}})
+	req.NoError(err)
+}
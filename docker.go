@@ -1,152 +1,1097 @@
 package main
 
 import (
+	"archive/tar"
+	"bufio"
 	"bytes"
-	"errors"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
-func checkDockerCommand() error {
-	cmd := exec.Command("docker")
-	return cmd.Run()
+const (
+	// build targets came with api 1.29
+	minDockerAPIVersion = "1.29"
+	maxDockerAPIVersion = "1.47"
+	defaultDockerHost   = "unix:///var/run/docker.sock"
+	// defaultRegistry is how the engine names the docker hub in credentials
+	defaultRegistry = "https://index.docker.io/v1/"
+)
+
+type DockerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *DockerError) Error() string {
+	if e.StatusCode == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("docker engine error %d: %s", e.StatusCode, e.Message)
+}
+
+func isDockerNotFound(err error) bool {
+	dockerErr, ok := err.(*DockerError)
+	return ok && dockerErr.StatusCode == http.StatusNotFound
+}
+
+func isDockerConflict(err error) bool {
+	dockerErr, ok := err.(*DockerError)
+	return ok && dockerErr.StatusCode == http.StatusConflict
 }
 
-func dockerBuildImage(buildContext, tag string) error {
-	Printf(ColorYellow, "Building docker image %q in %q\n", tag, buildContext)
-	cmd := exec.Command("docker", "build", "-t", tag, buildContext)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+type registryAuth struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	ServerAddress string `json:"serveraddress"`
+}
+
+type dockerMessage struct {
+	Stream      string `json:"stream"`
+	Status      string `json:"status"`
+	Progress    string `json:"progress"`
+	ID          string `json:"id"`
+	Error       string `json:"error"`
+	ErrorDetail struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+type DockerClient struct {
+	host        string
+	apiVersion  string
+	httpClient  *http.Client
+	auths       map[string]*registryAuth
+	prefix      string
+	prefixColor Color
+}
+
+func (c *DockerClient) withPrefix(prefix string, color Color) *DockerClient {
+	client := *c
+	client.prefix = prefix
+	client.prefixColor = color
+	return &client
+}
+
+func (c *DockerClient) printf(color Color, format string, v ...interface{}) {
+	if c.prefix == "" {
+		Printf(color, format, v...)
+		return
+	}
+	message := strings.TrimSuffix(fmt.Sprintf(format, v...), "\n")
+	for _, line := range strings.Split(message, "\n") {
+		PrintTextPrefixed(c.prefixColor, c.prefix, line)
+	}
+}
+
+func newDockerClient() (*DockerClient, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultDockerHost
+	}
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_HOST %q: %s", host, err.Error())
+	}
+	client := &DockerClient{
+		host:  host,
+		auths: readDockerConfigAuths(),
+	}
+	switch hostURL.Scheme {
+	case "unix":
+		socket := hostURL.Path
+		client.httpClient = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		}
+		client.host = "http://docker"
+	case "tcp", "http":
+		client.httpClient = &http.Client{}
+		client.host = "http://" + hostURL.Host
+	default:
+		return nil, fmt.Errorf("unsupported DOCKER_HOST %q", host)
+	}
+	return client, nil
+}
+
+// readDockerConfigAuths keys the credentials as imageRegistry names registries
+func readDockerConfigAuths() map[string]*registryAuth {
+	auths := make(map[string]*registryAuth)
+	data, err := ioutil.ReadFile(dockerConfigFile())
+	if err != nil {
+		return auths
+	}
+	config := struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}{}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return auths
+	}
+	helpers := make(map[string]string)
+	for registry, entry := range config.Auths {
+		if entry.Auth == "" {
+			// docker login leaves an empty entry for the credentials it stores
+			if config.CredsStore != "" {
+				helpers[registry] = config.CredsStore
+			}
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			continue
+		}
+		pieces := strings.SplitN(string(decoded), ":", 2)
+		if len(pieces) != 2 {
+			continue
+		}
+		auths[normalizeRegistry(registry)] = &registryAuth{
+			Username:      pieces[0],
+			Password:      pieces[1],
+			ServerAddress: registry,
+		}
+	}
+	for registry, helper := range config.CredHelpers {
+		helpers[registry] = helper
+	}
+	for registry, helper := range helpers {
+		auth, err := helperCredentials(helper, registry)
+		if err != nil {
+			Printf(ColorYellow, "Cannot read the docker credentials of %q from docker-credential-%s: %s\n", registry, helper, err.Error())
+			continue
+		}
+		if auth != nil {
+			auths[normalizeRegistry(registry)] = auth
+		}
+	}
+	return auths
+}
+
+func dockerConfigFile() string {
+	return filepath.Join(os.Getenv("HOME"), ".docker", "config.json")
+}
+
+func saveDockerConfigAuth(auth *registryAuth) error {
+	configFile := dockerConfigFile()
+	config := make(map[string]interface{})
+	data, err := ioutil.ReadFile(configFile)
 	if err == nil {
-		return nil
+		err = json.Unmarshal(data, &config)
+		if err != nil {
+			return fmt.Errorf("cannot read %q: %s", configFile, err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	auths, _ := config["auths"].(map[string]interface{})
+	if auths == nil {
+		auths = make(map[string]interface{})
+	}
+	helper, _ := config["credsStore"].(string)
+	credHelpers, _ := config["credHelpers"].(map[string]interface{})
+	registryHelper, ok := credHelpers[auth.ServerAddress].(string)
+	if ok {
+		helper = registryHelper
+	}
+	entry := make(map[string]interface{})
+	if helper != "" {
+		err = storeHelperCredentials(helper, auth)
+		if err != nil {
+			return err
+		}
+	} else {
+		entry["auth"] = base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+	}
+	auths[auth.ServerAddress] = entry
+	config["auths"] = auths
+	data, err = json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(configFile), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configFile, data, 0600)
+}
+
+func storeHelperCredentials(helper string, auth *registryAuth) error {
+	data, err := json.Marshal(map[string]string{
+		"ServerURL": auth.ServerAddress,
+		"Username":  auth.Username,
+		"Secret":    auth.Password,
+	})
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("docker-credential-"+helper, "store")
+	cmd.Stdin = bytes.NewReader(data)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot store the docker credentials of %q with docker-credential-%s: %s", auth.ServerAddress, helper, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func helperCredentials(helper, registry string) (*registryAuth, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+	output, err := cmd.Output()
+	if err != nil {
+		// Helpers answer on stdout that they know no such registry
+		if strings.Contains(string(output), "credentials not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	credentials := struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}{}
+	err = json.Unmarshal(output, &credentials)
+	if err != nil {
+		return nil, err
+	}
+	return &registryAuth{
+		Username:      credentials.Username,
+		Password:      credentials.Secret,
+		ServerAddress: registry,
+	}, nil
+}
+
+func normalizeRegistry(registry string) string {
+	if registry == defaultRegistry {
+		return registry
+	}
+	host := registry
+	scheme := strings.Index(host, "://")
+	if scheme >= 0 {
+		host = host[scheme+3:]
 	}
-	return errors.New("cannot build docker image")
+	host = strings.SplitN(host, "/", 2)[0]
+	switch host {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return defaultRegistry
+	}
+	return host
+}
+
+func (c *DockerClient) do(method, path string, query url.Values, body io.Reader, headers map[string]string) (*http.Response, error) {
+	requestURL := c.host + path
+	if c.apiVersion != "" {
+		requestURL = c.host + "/v" + c.apiVersion + path
+	}
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	request, err := http.NewRequest(method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 400 {
+		defer response.Body.Close()
+		content, _ := ioutil.ReadAll(response.Body)
+		message := struct {
+			Message string `json:"message"`
+		}{}
+		if json.Unmarshal(content, &message) != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(content))
+		}
+		return nil, &DockerError{StatusCode: response.StatusCode, Message: message.Message}
+	}
+	return response, nil
 }
 
-func dockerLogin(rootFolder string, credential *DockerCredential) error {
+func (c *DockerClient) Ping() error {
+	response, err := c.do("GET", "/version", nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("cannot connect to the docker engine at %s: %s", c.host, err.Error())
+	}
+	defer response.Body.Close()
+	version := struct {
+		APIVersion    string `json:"ApiVersion"`
+		MinAPIVersion string `json:"MinAPIVersion"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&version)
+	if err != nil {
+		return err
+	}
+	c.apiVersion, err = negotiateAPIVersion(version.APIVersion, version.MinAPIVersion)
+	return err
+}
+
+func negotiateAPIVersion(engineVersion, engineMinVersion string) (string, error) {
+	apiVersion := maxDockerAPIVersion
+	if engineVersion != "" && compareAPIVersions(engineVersion, apiVersion) < 0 {
+		apiVersion = engineVersion
+	}
+	if engineMinVersion != "" && compareAPIVersions(engineMinVersion, apiVersion) > 0 {
+		apiVersion = engineMinVersion
+	}
+	if compareAPIVersions(apiVersion, minDockerAPIVersion) < 0 {
+		return "", fmt.Errorf("docker engine api %s is too old, imladris needs %s or later", apiVersion, minDockerAPIVersion)
+	}
+	return apiVersion, nil
+}
+
+func compareAPIVersions(a, b string) int {
+	aPieces := strings.Split(a, ".")
+	bPieces := strings.Split(b, ".")
+	for i := 0; i < len(aPieces) || i < len(bPieces); i++ {
+		aPiece, bPiece := 0, 0
+		if i < len(aPieces) {
+			aPiece, _ = strconv.Atoi(aPieces[i])
+		}
+		if i < len(bPieces) {
+			bPiece, _ = strconv.Atoi(bPieces[i])
+		}
+		if aPiece != bPiece {
+			if aPiece < bPiece {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func (c *DockerClient) readProgress(body io.Reader) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		message := &dockerMessage{}
+		err := json.Unmarshal(scanner.Bytes(), message)
+		if err != nil {
+			continue
+		}
+		switch {
+		case message.ErrorDetail.Message != "":
+			return &DockerError{Message: message.ErrorDetail.Message}
+		case message.Error != "":
+			return &DockerError{Message: message.Error}
+		case message.Stream != "":
+			c.printf(ColorWhite, "%s", message.Stream)
+		case message.Progress != "":
+			continue
+		case message.ID != "":
+			c.printf(ColorWhite, "%s: %s\n", message.ID, message.Status)
+		case message.Status != "":
+			c.printf(ColorWhite, "%s\n", message.Status)
+		}
+	}
+	return scanner.Err()
+}
+
+func splitImage(name string) (string, string) {
+	slash := strings.LastIndex(name, "/")
+	colon := strings.LastIndex(name, ":")
+	if colon > slash {
+		return name[:colon], name[colon+1:]
+	}
+	return name, "latest"
+}
+
+func imageRegistry(name string) string {
+	pieces := strings.SplitN(name, "/", 2)
+	if len(pieces) == 2 && (strings.ContainsAny(pieces[0], ".:") || pieces[0] == "localhost") {
+		return normalizeRegistry(pieces[0])
+	}
+	return defaultRegistry
+}
+
+func (c *DockerClient) authHeader(registry string) (string, error) {
+	auth, ok := c.auths[registry]
+	if !ok {
+		auth = &registryAuth{}
+	}
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(data), nil
+}
+
+func (c *DockerClient) Login(rootFolder string, credential *DockerCredential) error {
 	host := credential.Host
-	username := credential.Username
 	password := credential.Password
 	if password == "" {
 		passwordFile := translateFilePath(rootFolder, credential.PasswordFile)
-		buf, err := ioutil.ReadFile(passwordFile)
+		buf, err := readSecretFile(passwordFile)
 		if err != nil {
 			return err
 		}
-		password = string(buf)
+		password = strings.TrimSpace(string(buf))
 	}
-	var cmd *exec.Cmd
 	if host == "" {
-		Println(ColorPurple, "Logging in to default docker registry")
-		cmd = exec.Command("docker", "login", "-u", username, "-p", password)
+		c.printf(ColorPurple, "Logging in to default docker registry\n")
+		host = defaultRegistry
 	} else {
-		Printf(ColorPurple, "Logging in to docker registry %q\n", host)
-		cmd = exec.Command("docker", "login", "-u", username, "-p", password, host)
+		c.printf(ColorPurple, "Logging in to docker registry %q\n", host)
 	}
-	errBuffer := &bytes.Buffer{}
-	cmd.Stderr = errBuffer
-	err := cmd.Run()
-	if err == nil {
-		return nil
+	auth := &registryAuth{
+		Username:      credential.Username,
+		Password:      password,
+		ServerAddress: host,
+	}
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+	response, err := c.do("POST", "/auth", nil, bytes.NewReader(data), map[string]string{
+		"Content-Type": "application/json",
+	})
+	if err != nil {
+		return err
 	}
-	return errors.New(errBuffer.String())
+	response.Body.Close()
+	c.auths[normalizeRegistry(host)] = auth
+	return saveDockerConfigAuth(auth)
 }
 
-func dockerRmi(name string) error {
-	Printf(ColorYellow, "Auto clean image %s\n", name)
-	var stdErr string
-	for i := 0; i < 20; i++ {
-		cmd := exec.Command("docker", "rmi", name)
-		errBuffer := &bytes.Buffer{}
-		cmd.Stderr = errBuffer
-		err := cmd.Run()
+type dockerImage struct {
+	ID     string `json:"Id"`
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+func (c *DockerClient) InspectImage(name string) (*dockerImage, error) {
+	response, err := c.do("GET", "/images/"+name+"/json", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	image := &dockerImage{}
+	err = json.NewDecoder(response.Body).Decode(image)
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (c *DockerClient) ImageExists(name string) (bool, error) {
+	_, err := c.InspectImage(name)
+	if isDockerNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *DockerClient) ListImagesWithLabel(label, value string) ([]string, error) {
+	filters, err := json.Marshal(map[string][]string{
+		"label": {label + "=" + value},
+	})
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.do("GET", "/images/json", url.Values{"filters": {string(filters)}}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	images := []struct {
+		ID string `json:"Id"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&images)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, image := range images {
+		ids = append(ids, image.ID)
+	}
+	return ids, nil
+}
+
+func (c *DockerClient) Pull(name string) error {
+	exists, err := c.ImageExists(name)
+	if err != nil || exists {
+		return err
+	}
+	return c.ForcePull(name)
+}
+
+func (c *DockerClient) ForcePull(name string) error {
+	c.printf(ColorYellow, "Pulling image %s\n", name)
+	auth, err := c.authHeader(imageRegistry(name))
+	if err != nil {
+		return err
+	}
+	repository, tag := splitImage(name)
+	response, err := c.do("POST", "/images/create", url.Values{
+		"fromImage": {repository},
+		"tag":       {tag},
+	}, nil, map[string]string{"X-Registry-Auth": auth})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return c.readProgress(response.Body)
+}
+
+type BuildOptions struct {
+	Tag        string
+	Dockerfile string
+	BuildArgs  map[string]string
+	Target     string
+	Labels     map[string]string
+	CacheFrom  []string
+	Network    string
+}
+
+const outsideDockerfile = ".imladris.Dockerfile"
+
+func (c *DockerClient) BuildImage(buildContext string, options *BuildOptions) error {
+	c.printf(ColorYellow, "Building docker image %q in %q\n", options.Tag, buildContext)
+	buildKit, err := dockerfileNeedsBuildKit(buildContext, options.Dockerfile)
+	if err != nil {
+		return err
+	}
+	if buildKit {
+		return c.buildImageWithCommand(buildContext, options)
+	}
+	archive, dockerfile, err := archiveBuildContext(buildContext, options.Dockerfile)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	query := url.Values{
+		"t":          {options.Tag},
+		"rm":         {"1"},
+		"dockerfile": {dockerfile},
+	}
+	if options.Target != "" {
+		query.Set("target", options.Target)
+	}
+	if options.Network != "" {
+		query.Set("networkmode", options.Network)
+	}
+	jsonParameters := map[string]interface{}{
+		"buildargs": options.BuildArgs,
+		"labels":    options.Labels,
+		"cachefrom": options.CacheFrom,
+	}
+	for key, value := range jsonParameters {
+		if isEmptyValue(value) {
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		query.Set(key, string(data))
+	}
+	// Every known credential is sent so that base images can be pulled
+	registryConfig, err := json.Marshal(c.auths)
+	if err != nil {
+		return err
+	}
+	response, err := c.do("POST", "/build", query, archive, map[string]string{
+		"Content-Type":      "application/x-tar",
+		"X-Registry-Config": base64.URLEncoding.EncodeToString(registryConfig),
+	})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	err = c.readProgress(response.Body)
+	if err != nil {
+		return fmt.Errorf("cannot build docker image %q: %s", options.Tag, err.Error())
+	}
+	return nil
+}
+
+// buildKitFlags are rejected by the legacy builder behind /build
+var buildKitFlags = map[string]struct{}{
+	"mount":        {},
+	"network":      {},
+	"security":     {},
+	"link":         {},
+	"chmod":        {},
+	"parents":      {},
+	"exclude":      {},
+	"checksum":     {},
+	"keep-git-dir": {},
+}
+
+func dockerfileNeedsBuildKit(buildContext, dockerfile string) (bool, error) {
+	if dockerfile == "" {
+		dockerfile = filepath.Join(buildContext, "Dockerfile")
+	}
+	data, err := ioutil.ReadFile(dockerfile)
+	if os.IsNotExist(err) {
+		// The engine reports the missing Dockerfile
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return needsBuildKit(string(data)), nil
+}
+
+func needsBuildKit(dockerfile string) bool {
+	directives := true
+	for _, line := range strings.Split(dockerfile, "\n") {
+		fields := strings.Fields(line)
+		if directives && len(fields) > 0 && strings.HasPrefix(fields[0], "#") {
+			directive := strings.ToLower(strings.Join(fields, ""))
+			if strings.HasPrefix(strings.TrimLeft(directive, "#"), "syntax=") {
+				return true
+			}
+			continue
+		}
+		directives = false
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "RUN", "COPY", "ADD":
+		default:
+			continue
+		}
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "<<") {
+				return true
+			}
+			if !strings.HasPrefix(field, "--") {
+				break
+			}
+			name := strings.SplitN(strings.TrimPrefix(field, "--"), "=", 2)[0]
+			_, ok := buildKitFlags[name]
+			if ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *DockerClient) buildImageWithCommand(buildContext string, options *BuildOptions) error {
+	_, err := exec.LookPath("docker")
+	if err != nil {
+		return fmt.Errorf("cannot build docker image %q: its Dockerfile needs BuildKit, which the docker engine api builds do not support, and the docker command is not installed", options.Tag)
+	}
+	c.printf(ColorWhite, "Dockerfile needs BuildKit, building with the docker command\n")
+	args := []string{"build", "--progress", "plain", "-t", options.Tag}
+	if options.Dockerfile != "" {
+		args = append(args, "-f", options.Dockerfile)
+	}
+	for _, key := range sortedKeys(options.BuildArgs) {
+		args = append(args, "--build-arg", key+"="+options.BuildArgs[key])
+	}
+	for _, key := range sortedKeys(options.Labels) {
+		args = append(args, "--label", key+"="+options.Labels[key])
+	}
+	for _, image := range options.CacheFrom {
+		args = append(args, "--cache-from", image)
+	}
+	if options.Target != "" {
+		args = append(args, "--target", options.Target)
+	}
+	if options.Network != "" {
+		args = append(args, "--network", options.Network)
+	}
+	args = append(args, buildContext)
+	cmd := exec.Command("docker", args...)
+	cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	go func() {
+		writer.CloseWithError(cmd.Wait())
+	}()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		c.printf(ColorWhite, "%s\n", scanner.Text())
+	}
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("cannot build docker image %q: %s", options.Tag, err.Error())
+	}
+	return nil
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// walkBuildContext visits files in lexical order, the context hash relies on it
+func walkBuildContext(buildContext, dockerfile string, fn func(path, name string, info os.FileInfo) error) (string, error) {
+	dockerfileName, outside, err := contextDockerfileName(buildContext, dockerfile)
+	if err != nil {
+		return "", err
+	}
+	excludes, err := readDockerignore(buildContext)
+	if err != nil {
+		return "", err
+	}
+	err = filepath.Walk(buildContext, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(buildContext, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath != dockerfileName && isDockerignored(relPath, excludes) {
+			if info.IsDir() && !hasDockerignoreExceptions(relPath, excludes) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(path, relPath, info)
+	})
+	if err != nil {
+		return "", err
+	}
+	if outside {
+		info, err := os.Stat(dockerfile)
+		if err != nil {
+			return "", err
+		}
+		err = fn(dockerfile, outsideDockerfile, info)
+		if err != nil {
+			return "", err
+		}
+	}
+	return dockerfileName, nil
+}
+
+func contextDockerfileName(buildContext, dockerfile string) (string, bool, error) {
+	if dockerfile == "" {
+		return "Dockerfile", false, nil
+	}
+	absContext, err := filepath.Abs(buildContext)
+	if err != nil {
+		return "", false, err
+	}
+	absDockerfile, err := filepath.Abs(dockerfile)
+	if err != nil {
+		return "", false, err
+	}
+	relPath, err := filepath.Rel(absContext, absDockerfile)
+	if err != nil {
+		return "", false, err
+	}
+	dockerfileName := filepath.ToSlash(relPath)
+	if strings.HasPrefix(dockerfileName, "../") {
+		return outsideDockerfile, true, nil
+	}
+	return dockerfileName, false, nil
+}
+
+// archiveBuildContext writes the tar while it is read, an error of the writer
+// is returned by Read
+func archiveBuildContext(buildContext, dockerfile string) (io.ReadCloser, string, error) {
+	dockerfileName, _, err := contextDockerfileName(buildContext, dockerfile)
+	if err != nil {
+		return nil, "", err
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		archive := tar.NewWriter(writer)
+		_, err := walkBuildContext(buildContext, dockerfile, func(path, name string, info os.FileInfo) error {
+			return addArchiveFile(archive, path, name, info)
+		})
 		if err == nil {
-			Printf(ColorGreen, "====> Success\n")
+			err = archive.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader, dockerfileName, nil
+}
+
+func buildContextHash(buildContext string, options *BuildOptions) (string, error) {
+	hash := sha256.New()
+	dockerfileName, err := walkBuildContext(buildContext, options.Dockerfile, func(path, name string, info os.FileInfo) error {
+		fmt.Fprintf(hash, "%s\x00%s\x00", name, info.Mode())
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s\x00", link)
 			return nil
 		}
-		stdErr = errBuffer.String()
-		if strings.Contains(stdErr, "must force") {
-			time.Sleep(5 * time.Second)
-			continue
-		} else {
-			return errors.New(stdErr)
+		if !info.Mode().IsRegular() {
+			return nil
 		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(hash, file)
+		hash.Write([]byte{0})
+		return err
+	})
+	if err != nil {
+		return "", err
 	}
-	return errors.New(stdErr)
+	data, err := buildOptionsData(dockerfileName, options)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-func dockerImageExistLocally(name string) bool {
-	cmd := exec.Command("docker", "images", name)
-	buff := &bytes.Buffer{}
-	cmd.Stdout = buff
-	cmd.Run()
-	pieces := strings.Split(name, ":")
-	if strings.Contains(buff.String(), pieces[0]) {
-		return true
+func buildOptionsHash(options *BuildOptions) (string, error) {
+	if options.Dockerfile == "" && len(options.BuildArgs) == 0 && options.Target == "" && len(options.Labels) == 0 && options.Network == "" {
+		return "", nil
 	}
-	return false
+	data, err := buildOptionsData(options.Dockerfile, options)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
 }
 
-func dockerPull(name string) error {
-	if dockerImageExistLocally(name) {
-		return nil
+func buildOptionsData(dockerfileName string, options *BuildOptions) ([]byte, error) {
+	// Maps are marshalled with sorted keys, the hash is stable
+	return json.Marshal(map[string]interface{}{
+		"dockerfile": dockerfileName,
+		"buildargs":  options.BuildArgs,
+		"target":     options.Target,
+		"labels":     options.Labels,
+		"network":    options.Network,
+	})
+}
+
+func addArchiveFile(writer *tar.Writer, path, name string, info os.FileInfo) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		link, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
 	}
-	Printf(ColorYellow, "Pulling image %s\n", name)
-	cmd := exec.Command("docker", "pull", name)
-	errBuffer := &bytes.Buffer{}
-	cmd.Stderr = errBuffer
-	cmd.Stdout = os.Stdout
-	err := cmd.Run()
-	if err == nil {
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
 		return err
 	}
-	return errors.New(errBuffer.String())
+	header.Name = name
+	err = writer.WriteHeader(header)
+	if err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(writer, file)
+	return err
 }
 
-func dockerPush(name string, pushLatest bool) error {
-	err := doDockerPush(name)
+// dockerignorePattern follows the engine: ** spans folders, a pattern also
+// matches the paths below a matched folder and the last matching line wins
+type dockerignorePattern struct {
+	regexp  *regexp.Regexp
+	prefix  string
+	negated bool
+}
+
+func readDockerignore(buildContext string) ([]*dockerignorePattern, error) {
+	data, err := ioutil.ReadFile(filepath.Join(buildContext, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	patterns := []*dockerignorePattern{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern := &dockerignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			pattern.negated = true
+			line = strings.TrimSpace(line[1:])
+		}
+		line = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(line)), "/")
+		pattern.regexp, err = compileDockerignore(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %s", line, err.Error())
+		}
+		pattern.prefix = line
+		wildcard := strings.IndexAny(line, "*?[\\")
+		if wildcard >= 0 {
+			pattern.prefix = line[:wildcard]
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func compileDockerignore(pattern string) (*regexp.Regexp, error) {
+	expression := "^"
+	for i := 0; i < len(pattern); i++ {
+		switch char := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expression += "(.*/)?"
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expression += ".*"
+			i++
+		case char == '*':
+			expression += "[^/]*"
+		case char == '?':
+			expression += "[^/]"
+		case char == '\\' && i+1 < len(pattern):
+			i++
+			expression += regexp.QuoteMeta(string(pattern[i]))
+		case strings.IndexByte(".+()|{}$", char) >= 0:
+			expression += "\\" + string(char)
+		default:
+			expression += string(char)
+		}
+	}
+	return regexp.Compile(expression + "$")
+}
+
+func isDockerignored(relPath string, patterns []*dockerignorePattern) bool {
+	if relPath == "Dockerfile" || relPath == ".dockerignore" {
+		return false
+	}
+	ignored := false
+	for _, pattern := range patterns {
+		for path := relPath; path != "." && path != "/"; path = filepath.ToSlash(filepath.Dir(path)) {
+			if pattern.regexp.MatchString(path) {
+				ignored = !pattern.negated
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+// hasDockerignoreExceptions tells whether an ignored folder must still be
+// walked because an exception may match below it
+func hasDockerignoreExceptions(folder string, patterns []*dockerignorePattern) bool {
+	for _, pattern := range patterns {
+		if !pattern.negated {
+			continue
+		}
+		if strings.HasPrefix(pattern.prefix, folder+"/") || strings.HasPrefix(folder+"/", pattern.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *DockerClient) Push(name string, pushLatest bool) error {
+	err := c.push(name)
 	if err != nil {
 		return err
 	}
 	if !pushLatest {
 		return nil
 	}
-	pieces := strings.Split(name, ":")
-	imageName := pieces[0]
-	latestImage := imageName + ":latest"
-	err = dockerTag(name, latestImage)
+	repository, _ := splitImage(name)
+	latestImage := repository + ":latest"
+	err = c.Tag(name, latestImage)
 	if err != nil {
 		return err
 	}
-	return doDockerPush(latestImage)
+	return c.push(latestImage)
 }
 
-func doDockerPush(name string) error {
-	Printf(ColorYellow, "Pushing image %s\n", name)
-	cmd := exec.Command("docker", "push", name)
-	errBuffer := &bytes.Buffer{}
-	cmd.Stderr = errBuffer
-	cmd.Stdout = os.Stdout
-	err := cmd.Run()
+func (c *DockerClient) push(name string) error {
+	c.printf(ColorYellow, "Pushing image %s\n", name)
+	auth, err := c.authHeader(imageRegistry(name))
 	if err != nil {
-		return errors.New(errBuffer.String())
+		return err
 	}
-	return nil
+	repository, tag := splitImage(name)
+	response, err := c.do("POST", "/images/"+repository+"/push", url.Values{
+		"tag": {tag},
+	}, nil, map[string]string{"X-Registry-Auth": auth})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return c.readProgress(response.Body)
 }
 
-func dockerTag(name, alias string) error {
-	Printf(ColorYellow, "Tagging %q as %q\n", name, alias)
-	cmd := exec.Command("docker", "tag", name, alias)
-	errBuffer := &bytes.Buffer{}
-	cmd.Stderr = errBuffer
-	cmd.Stdout = os.Stdout
-	err := cmd.Run()
+func (c *DockerClient) Tag(name, alias string) error {
+	c.printf(ColorYellow, "Tagging %q as %q\n", name, alias)
+	repository, tag := splitImage(alias)
+	response, err := c.do("POST", "/images/"+name+"/tag", url.Values{
+		"repo": {repository},
+		"tag":  {tag},
+	}, nil, nil)
 	if err != nil {
-		return errors.New(errBuffer.String())
+		return err
 	}
+	response.Body.Close()
 	return nil
 }
+
+func (c *DockerClient) RemoveImage(name string) error {
+	c.printf(ColorYellow, "Auto clean image %s\n", name)
+	var err error
+	for i := 0; i < 20; i++ {
+		var response *http.Response
+		response, err = c.do("DELETE", "/images/"+name, nil, nil, nil)
+		if err == nil {
+			response.Body.Close()
+			c.printf(ColorGreen, "====> Success\n")
+			return nil
+		}
+		if !isDockerConflict(err) {
+			return err
+		}
+		time.Sleep(5 * time.Second)
+	}
+	return err
+}
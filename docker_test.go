@@ -0,0 +1,362 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitImage(t *testing.T) {
+	req := require.New(t)
+	repository, tag := splitImage("nginx")
+	req.Equal("nginx", repository)
+	req.Equal("latest", tag)
+	repository, tag = splitImage("localhost:5000/team/app:1.2")
+	req.Equal("localhost:5000/team/app", repository)
+	req.Equal("1.2", tag)
+	repository, tag = splitImage("localhost:5000/app")
+	req.Equal("localhost:5000/app", repository)
+	req.Equal("latest", tag)
+
+	req.Equal(defaultRegistry, imageRegistry("nginx:1.17"))
+	req.Equal(defaultRegistry, imageRegistry("team/app"))
+	req.Equal("gcr.io", imageRegistry("gcr.io/project/app"))
+	req.Equal("localhost", imageRegistry("localhost/app"))
+	req.Equal(defaultRegistry, imageRegistry("docker.io/library/nginx"))
+
+	req.Equal(defaultRegistry, normalizeRegistry("https://index.docker.io/v1/"))
+	req.Equal(defaultRegistry, normalizeRegistry("registry-1.docker.io"))
+	req.Equal("gcr.io", normalizeRegistry("https://gcr.io/v2/"))
+	req.Equal("localhost:5000", normalizeRegistry("localhost:5000"))
+}
+
+func TestReadDockerConfigAuths(t *testing.T) {
+	req := require.New(t)
+	home, err := ioutil.TempDir("", "imladris-home")
+	req.NoError(err)
+	defer os.RemoveAll(home)
+	req.NoError(os.MkdirAll(filepath.Join(home, ".docker"), 0755))
+	req.NoError(ioutil.WriteFile(filepath.Join(home, ".docker", "config.json"), []byte(`{
+		"auths": {
+			"https://index.docker.io/v1/": {},
+			"https://gcr.io/v2/": {"auth": "`+base64.StdEncoding.EncodeToString([]byte("elrond:mellon"))+`"}
+		},
+		"credsStore": "fake",
+		"credHelpers": {"registry.example.com": "fake"}
+	}`), 0644))
+	// The fake helper knows every registry but the example one
+	helper := `#!/bin/sh
+read registry
+if [ "$registry" = registry.example.com ]; then
+	echo "credentials not found in native keychain"
+	exit 1
+fi
+echo '{"Username":"galadriel","Secret":"nenya"}'
+`
+	req.NoError(ioutil.WriteFile(filepath.Join(home, "docker-credential-fake"), []byte(helper), 0755))
+	oldHome := os.Getenv("HOME")
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("HOME", oldHome)
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("HOME", home)
+	os.Setenv("PATH", home+string(os.PathListSeparator)+oldPath)
+
+	auths := readDockerConfigAuths()
+	req.Len(auths, 2)
+	req.Equal("elrond", auths["gcr.io"].Username)
+	req.Equal("mellon", auths["gcr.io"].Password)
+	req.Equal("galadriel", auths[defaultRegistry].Username)
+	req.Equal("nenya", auths[defaultRegistry].Password)
+}
+
+func TestSaveDockerConfigAuth(t *testing.T) {
+	req := require.New(t)
+	home, err := ioutil.TempDir("", "imladris-home")
+	req.NoError(err)
+	defer os.RemoveAll(home)
+	oldHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", oldHome)
+	os.Setenv("HOME", home)
+
+	req.NoError(saveDockerConfigAuth(&registryAuth{Username: "elrond", Password: "mellon", ServerAddress: "gcr.io"}))
+	configFile := filepath.Join(home, ".docker", "config.json")
+	data, err := ioutil.ReadFile(configFile)
+	req.NoError(err)
+	req.NoError(ioutil.WriteFile(configFile, []byte(strings.Replace(string(data), "{", `{"detachKeys":"ctrl-e",`, 1)), 0600))
+	req.NoError(saveDockerConfigAuth(&registryAuth{Username: "galadriel", Password: "nenya", ServerAddress: defaultRegistry}))
+
+	auths := readDockerConfigAuths()
+	req.Len(auths, 2)
+	req.Equal("mellon", auths["gcr.io"].Password)
+	req.Equal("galadriel", auths[defaultRegistry].Username)
+	data, err = ioutil.ReadFile(configFile)
+	req.NoError(err)
+	req.Contains(string(data), `"detachKeys": "ctrl-e"`)
+}
+
+func TestReadProgress(t *testing.T) {
+	req := require.New(t)
+	stream := strings.Join([]string{
+		`{"stream":"Step 1/2 : FROM alpine\n"}`,
+		`{"status":"Downloading","progress":"[==>  ]","id":"abc"}`,
+		`{"stream":"Step 2/2 : RUN false\n"}`,
+		`{"error":"returned a non-zero code: 1","errorDetail":{"message":"returned a non-zero code: 1"}}`,
+	}, "\n")
+	client := &DockerClient{}
+	err := client.readProgress(strings.NewReader(stream))
+	req.Error(err)
+	dockerErr, ok := err.(*DockerError)
+	req.True(ok)
+	req.Equal(0, dockerErr.StatusCode)
+	req.Equal("returned a non-zero code: 1", dockerErr.Message)
+
+	req.NoError(client.readProgress(strings.NewReader(`{"status":"Pushed","id":"abc"}`)))
+}
+
+func TestArchiveBuildContext(t *testing.T) {
+	req := require.New(t)
+	folder, err := ioutil.TempDir("", "imladris-build")
+	req.NoError(err)
+	defer os.RemoveAll(folder)
+	files := map[string]string{
+		"Dockerfile":      "FROM alpine\n",
+		".dockerignore":   "# comment\nnode_modules\n*.log\n!keep.log\n",
+		"main.go":         "package main\n",
+		"debug.log":       "noise",
+		"keep.log":        "kept",
+		"node_modules/a":  "dependency",
+		"src/nested/b.go": "package nested\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(folder, name)
+		req.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		req.NoError(ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	archive, dockerfile, err := archiveBuildContext(folder, "")
+	req.NoError(err)
+	req.Equal("Dockerfile", dockerfile)
+	req.Equal([]string{".dockerignore", "Dockerfile", "keep.log", "main.go", "src", "src/nested", "src/nested/b.go"}, archiveNames(t, archive))
+
+	// An ignored Dockerfile is still sent
+	archive, dockerfile, err = archiveBuildContext(folder, filepath.Join(folder, "debug.log"))
+	req.NoError(err)
+	req.Equal("debug.log", dockerfile)
+	req.Contains(archiveNames(t, archive), "debug.log")
+
+	outside := filepath.Join(filepath.Dir(folder), filepath.Base(folder)+".Dockerfile")
+	req.NoError(ioutil.WriteFile(outside, []byte("FROM scratch\n"), 0644))
+	defer os.Remove(outside)
+	archive, dockerfile, err = archiveBuildContext(folder, outside)
+	req.NoError(err)
+	req.Equal(outsideDockerfile, dockerfile)
+	req.Contains(archiveNames(t, archive), outsideDockerfile)
+
+	// Errors of the streamed archive are returned when it is read
+	archive, _, err = archiveBuildContext(filepath.Join(folder, "missing"), "")
+	req.NoError(err)
+	_, err = ioutil.ReadAll(archive)
+	req.Error(err)
+}
+
+func TestDockerignore(t *testing.T) {
+	req := require.New(t)
+	folder, err := ioutil.TempDir("", "imladris-build")
+	req.NoError(err)
+	defer os.RemoveAll(folder)
+	files := map[string]string{
+		"Dockerfile":             "FROM alpine\n",
+		".dockerignore":          "**/*.tmp\nvendor\n!vendor/keep/**\ndocs/*/draft\n",
+		"a.tmp":                  "noise",
+		"src/deep/b.tmp":         "noise",
+		"src/deep/b.go":          "package deep\n",
+		"vendor/lib/c.go":        "package lib\n",
+		"vendor/keep/d.go":       "package keep\n",
+		"docs/guide/draft/e.md":  "draft",
+		"docs/guide/index.md":    "guide",
+		"docs/guide/more/draft":  "kept",
+		"docs/guide/more/f.md":   "kept",
+		"docs/guide/index.md.gz": "kept",
+	}
+	for name, content := range files {
+		path := filepath.Join(folder, name)
+		req.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		req.NoError(ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	names := []string{}
+	_, err = walkBuildContext(folder, "", func(path, name string, info os.FileInfo) error {
+		if !info.IsDir() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	req.NoError(err)
+	req.Equal([]string{
+		".dockerignore",
+		"Dockerfile",
+		"docs/guide/index.md",
+		"docs/guide/index.md.gz",
+		"docs/guide/more/draft",
+		"docs/guide/more/f.md",
+		"src/deep/b.go",
+		"vendor/keep/d.go",
+	}, names)
+}
+
+func TestBuildContextHash(t *testing.T) {
+	req := require.New(t)
+	folder, err := ioutil.TempDir("", "imladris-build")
+	req.NoError(err)
+	defer os.RemoveAll(folder)
+	req.NoError(ioutil.WriteFile(filepath.Join(folder, "Dockerfile"), []byte("FROM alpine\n"), 0644))
+	req.NoError(ioutil.WriteFile(filepath.Join(folder, ".dockerignore"), []byte("*.log\n"), 0644))
+	options := &BuildOptions{Tag: "anduin/app:1.0"}
+
+	hash, err := buildContextHash(folder, options)
+	req.NoError(err)
+	same, err := buildContextHash(folder, options)
+	req.NoError(err)
+	req.Equal(hash, same)
+
+	// Ignored files and the tag do not change the hash
+	req.NoError(ioutil.WriteFile(filepath.Join(folder, "debug.log"), []byte("noise"), 0644))
+	same, err = buildContextHash(folder, &BuildOptions{Tag: "anduin/app:1.1"})
+	req.NoError(err)
+	req.Equal(hash, same)
+
+	withArgs, err := buildContextHash(folder, &BuildOptions{BuildArgs: map[string]string{"VERSION": "1"}})
+	req.NoError(err)
+	req.NotEqual(hash, withArgs)
+
+	req.NoError(ioutil.WriteFile(filepath.Join(folder, "main.go"), []byte("package main\n"), 0644))
+	changed, err := buildContextHash(folder, options)
+	req.NoError(err)
+	req.NotEqual(hash, changed)
+}
+
+func archiveNames(t *testing.T, archive io.Reader) []string {
+	reader := tar.NewReader(archive)
+	names := []string{}
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDockerBuildOptions(t *testing.T) {
+	req := require.New(t)
+	folder, err := ioutil.TempDir("", "imladris-build")
+	req.NoError(err)
+	defer os.RemoveAll(folder)
+	req.NoError(ioutil.WriteFile(filepath.Join(folder, "Dockerfile"), []byte("FROM alpine\n"), 0644))
+
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"stream":"Successfully built abc\n"}`))
+	}))
+	defer server.Close()
+	os.Setenv("DOCKER_HOST", strings.Replace(server.URL, "http://", "tcp://", 1))
+	defer os.Unsetenv("DOCKER_HOST")
+
+	client, err := newDockerClient()
+	req.NoError(err)
+	err = client.BuildImage(folder, &BuildOptions{
+		Tag:       "anduin/app:2.0",
+		BuildArgs: map[string]string{"VERSION": "2.0.2"},
+		Target:    "runtime",
+		CacheFrom: []string{"anduin/app:latest"},
+		Network:   "host",
+	})
+	req.NoError(err)
+	req.Equal("anduin/app:2.0", query.Get("t"))
+	req.Equal("Dockerfile", query.Get("dockerfile"))
+	req.Equal(`{"VERSION":"2.0.2"}`, query.Get("buildargs"))
+	req.Equal("runtime", query.Get("target"))
+	req.Equal(`["anduin/app:latest"]`, query.Get("cachefrom"))
+	req.Equal("host", query.Get("networkmode"))
+	_, ok := query["labels"]
+	req.False(ok)
+}
+
+func TestNeedsBuildKit(t *testing.T) {
+	req := require.New(t)
+	req.False(needsBuildKit("# build the app\nFROM golang:1.13 AS build\nCOPY --from=build --chown=app /app /app\nRUN go build ./...\n"))
+	req.True(needsBuildKit("# syntax=docker/dockerfile:1\nFROM alpine\n"))
+	req.True(needsBuildKit("FROM golang:1.13\nRUN --mount=type=cache,target=/root/.cache go build ./...\n"))
+	req.True(needsBuildKit("FROM alpine\ncopy --chown=app --link app /app\n"))
+	req.True(needsBuildKit("FROM alpine\nRUN <<EOF\necho hello\nEOF\n"))
+	// Directives are only read before the first instruction
+	req.False(needsBuildKit("FROM alpine\n# syntax=docker/dockerfile:1\n"))
+}
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	req := require.New(t)
+	apiVersion, err := negotiateAPIVersion("1.41", "1.12")
+	req.NoError(err)
+	req.Equal("1.41", apiVersion)
+	apiVersion, err = negotiateAPIVersion("1.52", "1.44")
+	req.NoError(err)
+	req.Equal(maxDockerAPIVersion, apiVersion)
+	apiVersion, err = negotiateAPIVersion("1.60", "1.50")
+	req.NoError(err)
+	req.Equal("1.50", apiVersion)
+	_, err = negotiateAPIVersion("1.26", "")
+	req.Error(err)
+	req.Equal(1, compareAPIVersions("1.100", "1.47"))
+}
+
+func TestDockerClientErrors(t *testing.T) {
+	req := require.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/version":
+			w.Write([]byte(`{"ApiVersion":"1.41","MinAPIVersion":"1.12"}`))
+		case r.URL.Path == "/v1.41/images/present:1.0/json":
+			w.Write([]byte(`{"Id":"sha256:abc"}`))
+		case r.Method == "DELETE":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"image is referenced in multiple repositories"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"no such image"}`))
+		}
+	}))
+	defer server.Close()
+	os.Setenv("DOCKER_HOST", strings.Replace(server.URL, "http://", "tcp://", 1))
+	defer os.Unsetenv("DOCKER_HOST")
+
+	client, err := newDockerClient()
+	req.NoError(err)
+	req.NoError(client.Ping())
+	exists, err := client.ImageExists("present:1.0")
+	req.NoError(err)
+	req.True(exists)
+	// Only exact names exist, not every image containing the name
+	exists, err = client.ImageExists("present")
+	req.NoError(err)
+	req.False(exists)
+
+	err = client.RemoveImage("present:1.0")
+	req.Error(err)
+	req.False(isDockerConflict(err))
+	req.Equal(http.StatusForbidden, err.(*DockerError).StatusCode)
+	req.Equal("image is referenced in multiple repositories", err.(*DockerError).Message)
+}
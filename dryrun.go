@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// dryRunAll asks the api server to validate a request, admission included,
+// without persisting it
+var dryRunAll = []string{apiv1.DryRunAll}
+
+// supportsDryRun tells whether the api server honours the dryRun parameter.
+// It came with kubernetes 1.13, older servers ignore it and would really
+// apply the change.
+func supportsDryRun(kubeClient *KubeClient) (bool, error) {
+	version, err := kubeClient.Discovery().ServerVersion()
+	if err != nil {
+		return false, err
+	}
+	major, err := strconv.Atoi(version.Major)
+	if err != nil {
+		return false, nil
+	}
+	// Some providers report minor versions such as "13+"
+	minor, err := strconv.Atoi(strings.TrimSuffix(version.Minor, "+"))
+	if err != nil {
+		return false, nil
+	}
+	return major > 1 || (major == 1 && minor >= 13), nil
+}
+
+func dryRunObject(kubeClient *KubeClient, apiVersion, kind, namespace string, resourceData interface{}) (dynamic.ResourceInterface, *unstructured.Unstructured, error) {
+	mapping, err := kubeClient.resourceMapping(apiVersion, kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	resource, err := kubeClient.resourceInterface(apiVersion, kind, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := toUnstructuredMap(resourceData)
+	if err != nil {
+		return nil, nil, err
+	}
+	pruneGeneratedFields(content)
+	object := &unstructured.Unstructured{Object: content}
+	object.SetGroupVersionKind(mapping.GroupVersionKind)
+	return resource, object, nil
+}
+
+func dryRunCreateResource(kubeClient *KubeClient, apiVersion, kind, namespace string, resourceData interface{}) error {
+	resource, object, err := dryRunObject(kubeClient, apiVersion, kind, namespace, resourceData)
+	if err != nil {
+		return err
+	}
+	_, err = resource.Create(object, apiv1.CreateOptions{DryRun: dryRunAll})
+	return err
+}
+
+func dryRunUpdateResource(kubeClient *KubeClient, apiVersion, kind, name, namespace string, resourceData interface{}) error {
+	if isRecreatedKind(apiVersion, kind) {
+		// Jobs and pods are recreated rather than updated, only the deletion
+		// can be checked while the old object still exists
+		return dryRunDestroyResource(kubeClient, apiVersion, kind, name, namespace)
+	}
+	resource, object, err := dryRunObject(kubeClient, apiVersion, kind, namespace, resourceData)
+	if err != nil {
+		return err
+	}
+	// A merge patch keeps the fields the cluster filled in, e.g. the cluster
+	// ip of services, like updateResource does
+	data, err := object.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = resource.Patch(name, types.MergePatchType, data, apiv1.PatchOptions{DryRun: dryRunAll})
+	return err
+}
+
+func dryRunDestroyResource(kubeClient *KubeClient, apiVersion, kind, name, namespace string) error {
+	resource, err := kubeClient.resourceInterface(apiVersion, kind, namespace)
+	if err != nil {
+		return err
+	}
+	options := cascadingDeleteOptions()
+	options.DryRun = dryRunAll
+	err = resource.Delete(name, options)
+	if isResourceNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// resourceMapping resolves an api version and a lower case kind, as found in
+// assets, to the rest mapping served by the cluster
+func (c *KubeClient) resourceMapping(apiVersion, kind string) (*meta.RESTMapping, error) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, err
+	}
+	gvk, err := c.mapper.KindFor(gv.WithResource(kind))
+	if meta.IsNoMatchError(err) {
+		// The kind may come from a CRD created after the discovery cache was filled
+		c.mapper.Reset()
+		gvk, err = c.mapper.KindFor(gv.WithResource(kind))
+	}
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, UnsupportedResource(kind)
+		}
+		return nil, err
+	}
+	return c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+func (c *KubeClient) resourceInterface(apiVersion, kind, namespace string) (dynamic.ResourceInterface, error) {
+	mapping, err := c.resourceMapping(apiVersion, kind)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return c.dynamicClient.Resource(mapping.Resource), nil
+	}
+	return c.dynamicClient.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+func checkGenericResourceExist(kubeClient *KubeClient, apiVersion, kind, name, namespace string) (bool, error) {
+	resource, err := kubeClient.resourceInterface(apiVersion, kind, namespace)
+	if err != nil {
+		return false, err
+	}
+	_, err = resource.Get(name, apiv1.GetOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if isResourceNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func getGenericResource(kubeClient *KubeClient, apiVersion, kind, name, namespace string) (*unstructured.Unstructured, error) {
+	resource, err := kubeClient.resourceInterface(apiVersion, kind, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return resource.Get(name, apiv1.GetOptions{})
+}
+
+func createGenericResource(kubeClient *KubeClient, apiVersion, kind, namespace string, resourceData interface{}) error {
+	object, ok := resourceData.(*unstructured.Unstructured)
+	if !ok {
+		return UnsupportedResource(kind)
+	}
+	resource, err := kubeClient.resourceInterface(apiVersion, kind, namespace)
+	if err != nil {
+		return err
+	}
+	_, err = resource.Create(object, apiv1.CreateOptions{})
+	return err
+}
+
+func destroyGenericResource(kubeClient *KubeClient, apiVersion, kind, name, namespace string) error {
+	resource, err := kubeClient.resourceInterface(apiVersion, kind, namespace)
+	if err != nil {
+		return err
+	}
+	return resource.Delete(name, cascadingDeleteOptions())
+}
+
+func updateGenericResource(kubeClient *KubeClient, apiVersion, kind, name, namespace string, resourceData interface{}) error {
+	object, ok := resourceData.(*unstructured.Unstructured)
+	if !ok {
+		return UnsupportedResource(kind)
+	}
+	resource, err := kubeClient.resourceInterface(apiVersion, kind, namespace)
+	if err != nil {
+		return err
+	}
+	current, err := resource.Get(name, apiv1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	object = object.DeepCopy()
+	object.SetResourceVersion(current.GetResourceVersion())
+	_, err = resource.Update(object, apiv1.UpdateOptions{})
+	return err
+}
+
+// podSpecPaths lists where the pod spec lives in the common workload kinds
+var podSpecPaths = [][]string{
+	{"spec"},
+	{"spec", "template", "spec"},
+	{"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+func getGenericResourceImages(kind string, resourceData interface{}) ([]string, error) {
+	object, ok := resourceData.(*unstructured.Unstructured)
+	if !ok {
+		return nil, UnsupportedResource(kind)
+	}
+	images := []string{}
+	for _, path := range podSpecPaths {
+		containers, found, err := unstructured.NestedSlice(object.Object, append(path, "containers")...)
+		if err != nil || !found {
+			continue
+		}
+		for _, container := range containers {
+			containerMap, ok := container.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			image, ok := containerMap["image"].(string)
+			if ok {
+				images = append(images, image)
+			}
+		}
+	}
+	return images, nil
+}
+
+// listLabelledObjects returns the top level objects of every namespaced kind
+// served by the cluster that match the label selector
+func listLabelledObjects(kubeClient *KubeClient, namespace, labelSelector string) ([]unstructured.Unstructured, error) {
+	resourceLists, err := kubeClient.Discovery().ServerPreferredNamespacedResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	objects := []unstructured.Unstructured{}
+	for _, resourceList := range resourceLists {
+		gv, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resourceList.APIResources {
+			if strings.Contains(resource.Name, "/") || !hasVerb(resource.Verbs, "list") {
+				continue
+			}
+			list, err := kubeClient.dynamicClient.Resource(gv.WithResource(resource.Name)).Namespace(namespace).List(apiv1.ListOptions{
+				LabelSelector: labelSelector,
+			})
+			if err != nil {
+				if isResourceNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			for _, item := range list.Items {
+				// Objects owned by another one go away with their owner
+				if len(item.GetOwnerReferences()) > 0 {
+					continue
+				}
+				objects = append(objects, item)
+			}
+		}
+	}
+	return objects, nil
+}
+
+func hasVerb(verbs []string, verb string) bool {
+	for _, v := range verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// toUnstructuredMap converts typed and unstructured resource data alike to
+// the generic map representation used by the dynamic client
+func toUnstructuredMap(resourceData interface{}) (map[string]interface{}, error) {
+	object, ok := resourceData.(*unstructured.Unstructured)
+	if ok {
+		return runtime.DeepCopyJSON(object.Object), nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(resourceData)
+}
+
+// emptyFieldsWithMeaning are the fields that do not mean the same once
+// removed when empty, e.g. an empty namespace selector selects every namespace
+var emptyFieldsWithMeaning = map[string]struct{}{
+	"emptyDir":          {},
+	"labelSelector":     {},
+	"namespaceSelector": {},
+	"podSelector":       {},
+	"selector":          {},
+}
+
+// pruneGeneratedFields removes the fields that typed objects always carry
+// once serialized but that belong to the cluster, and the null and empty
+// fields of nested structs such as creationTimestamp, resources or strategy
+func pruneGeneratedFields(object map[string]interface{}) {
+	delete(object, "status")
+	pruneEmptyFields(object)
+}
+
+func pruneEmptyFields(object map[string]interface{}) {
+	for key, value := range object {
+		if value == nil {
+			delete(object, key)
+			continue
+		}
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			pruneEmptyFields(typed)
+			_, meaningful := emptyFieldsWithMeaning[key]
+			if len(typed) == 0 && !meaningful {
+				delete(object, key)
+			}
+		case []interface{}:
+			// List items are kept even when empty, an empty rule allows all
+			for _, item := range typed {
+				itemMap, ok := item.(map[string]interface{})
+				if ok {
+					pruneEmptyFields(itemMap)
+				}
+			}
+		}
+	}
+}
@@ -23,13 +23,13 @@ func TestInteg(t *testing.T) {
 	req.NotNil(project)
 	err = project.Up()
 	req.NoError(err)
-	ok, err := checkResourceExist(clientset, "deployment", "consul", "anduin")
+	ok, err := checkResourceExist(clientset, "extensions/v1beta1", "deployment", "consul", "anduin")
 	req.NoError(err)
 	req.True(ok)
-	ok, err = checkResourceExist(clientset, "service", "consul", "anduin")
+	ok, err = checkResourceExist(clientset, "v1", "service", "consul", "anduin")
 	req.NoError(err)
 	req.True(ok)
-	ok, err = checkResourceExist(clientset, "job", "init", "anduin")
+	ok, err = checkResourceExist(clientset, "batch/v1", "job", "init", "anduin")
 	req.NoError(err)
 	req.True(ok)
 
@@ -37,13 +37,13 @@ func TestInteg(t *testing.T) {
 
 	err = project.Down()
 	req.NoError(err)
-	ok, err = checkResourceExist(clientset, "deployment", "consul", "anduin")
+	ok, err = checkResourceExist(clientset, "extensions/v1beta1", "deployment", "consul", "anduin")
 	req.NoError(err)
 	req.False(ok)
-	ok, err = checkResourceExist(clientset, "service", "consul", "anduin")
+	ok, err = checkResourceExist(clientset, "v1", "service", "consul", "anduin")
 	req.NoError(err)
 	req.False(ok)
-	ok, err = checkResourceExist(clientset, "job", "init", "anduin")
+	ok, err = checkResourceExist(clientset, "batch/v1", "job", "init", "anduin")
 	req.NoError(err)
 	req.False(ok)
 }
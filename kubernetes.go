@@ -1,24 +1,41 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v2"
+	appsv1 "k8s.io/api/apps/v1"
 	app "k8s.io/api/apps/v1beta1"
+	appsv1beta2 "k8s.io/api/apps/v1beta2"
 	v1batch "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	rbac "k8s.io/api/rbac/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-func loadKubernetesClient(config *appConfig) (*kubernetes.Clientset, error) {
+// KubeClient bundles the typed clientset with a dynamic client and a
+// discovery backed rest mapper for the resource kinds without a typed client
+type KubeClient struct {
+	*kubernetes.Clientset
+	dynamicClient dynamic.Interface
+	mapper        *restmapper.DeferredDiscoveryRESTMapper
+}
+
+func loadKubernetesClient(config *appConfig) (*KubeClient, error) {
 	clientConfigLoader := &clientcmd.ClientConfigLoadingRules{
 		ExplicitPath: config.configFile,
 	}
@@ -30,7 +47,19 @@ func loadKubernetesClient(config *appConfig) (*kubernetes.Clientset, error) {
 	if err != nil {
 		return nil, err
 	}
-	return kubernetes.NewForConfig(kubeConfig)
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &KubeClient{
+		Clientset:     clientset,
+		dynamicClient: dynamicClient,
+		mapper:        restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery())),
+	}, nil
 }
 
 type KubernetesResource struct {
@@ -50,7 +79,7 @@ func loadKubernetesResource(data []byte) (*KubernetesResource, error) {
 	return r, nil
 }
 
-func createNamespace(kubeClient *kubernetes.Clientset, namespace string) error {
+func createNamespace(kubeClient *KubeClient, namespace string) error {
 	_, err := kubeClient.Core().Namespaces().Get(namespace, apiv1.GetOptions{})
 	if err == nil {
 		return nil
@@ -67,7 +96,7 @@ func createNamespace(kubeClient *kubernetes.Clientset, namespace string) error {
 	return err
 }
 
-func deleteNamespace(kubeClient *kubernetes.Clientset, namespace string) error {
+func deleteNamespace(kubeClient *KubeClient, namespace string) error {
 	if namespace == "default" {
 		return nil
 	}
@@ -91,10 +120,10 @@ func deleteNamespace(kubeClient *kubernetes.Clientset, namespace string) error {
 	return nil
 }
 
-func checkResourceExist(kubeClient *kubernetes.Clientset, kind, name, namespace string) (bool, error) {
+func checkResourceExist(kubeClient *KubeClient, apiVersion, kind, name, namespace string) (bool, error) {
 	var err error
-	switch kind {
-	case "pod":
+	switch resourceKey(apiVersion, kind) {
+	case "v1/pod":
 		pod, err := kubeClient.Core().Pods(namespace).Get(name, apiv1.GetOptions{})
 		if err != nil {
 			if isResourceNotExist(err) {
@@ -110,38 +139,60 @@ func checkResourceExist(kubeClient *kubernetes.Clientset, kind, name, namespace
 		default:
 			return true, nil
 		}
-	case "deployment":
+	case "extensions/v1beta1/deployment":
 		_, err = kubeClient.Extensions().Deployments(namespace).Get(name, apiv1.GetOptions{})
-	case "service":
+	case "apps/v1beta1/deployment":
+		_, err = kubeClient.AppsV1beta1().Deployments(namespace).Get(name, apiv1.GetOptions{})
+	case "apps/v1beta2/deployment":
+		_, err = kubeClient.AppsV1beta2().Deployments(namespace).Get(name, apiv1.GetOptions{})
+	case "apps/v1/deployment":
+		_, err = kubeClient.AppsV1().Deployments(namespace).Get(name, apiv1.GetOptions{})
+	case "v1/service":
 		_, err = kubeClient.Core().Services(namespace).Get(name, apiv1.GetOptions{})
-	case "job":
+	case "batch/v1/job":
 		_, err = kubeClient.Batch().Jobs(namespace).Get(name, apiv1.GetOptions{})
-	case "persistentvolumeclaim":
+	case "v1/persistentvolumeclaim":
 		_, err = kubeClient.Core().PersistentVolumeClaims(namespace).Get(name, apiv1.GetOptions{})
-	case "configmap":
+	case "v1/configmap":
 		_, err = kubeClient.Core().ConfigMaps(namespace).Get(name, apiv1.GetOptions{})
-	case "secret":
+	case "v1/secret":
 		_, err = kubeClient.Core().Secrets(namespace).Get(name, apiv1.GetOptions{})
-	case "ingress":
+	case "extensions/v1beta1/ingress":
 		_, err = kubeClient.Extensions().Ingresses(namespace).Get(name, apiv1.GetOptions{})
-	case "endpoints":
+	case "v1/endpoints":
 		_, err = kubeClient.Core().Endpoints(namespace).Get(name, apiv1.GetOptions{})
-	case "daemonset":
+	case "extensions/v1beta1/daemonset":
 		_, err = kubeClient.Extensions().DaemonSets(namespace).Get(name, apiv1.GetOptions{})
-	case "serviceaccount":
+	case "apps/v1beta2/daemonset":
+		_, err = kubeClient.AppsV1beta2().DaemonSets(namespace).Get(name, apiv1.GetOptions{})
+	case "apps/v1/daemonset":
+		_, err = kubeClient.AppsV1().DaemonSets(namespace).Get(name, apiv1.GetOptions{})
+	case "v1/serviceaccount":
 		_, err = kubeClient.Core().ServiceAccounts(namespace).Get(name, apiv1.GetOptions{})
-	case "role":
+	case "rbac.authorization.k8s.io/v1beta1/role":
 		_, err = kubeClient.RbacV1beta1().Roles(namespace).Get(name, apiv1.GetOptions{})
-	case "clusterrole":
+	case "rbac.authorization.k8s.io/v1beta1/clusterrole":
 		_, err = kubeClient.RbacV1beta1().ClusterRoles().Get(name, apiv1.GetOptions{})
-	case "rolebinding":
+	case "rbac.authorization.k8s.io/v1beta1/rolebinding":
 		_, err = kubeClient.RbacV1beta1().RoleBindings(namespace).Get(name, apiv1.GetOptions{})
-	case "clusterrolebinding":
+	case "rbac.authorization.k8s.io/v1beta1/clusterrolebinding":
 		_, err = kubeClient.RbacV1beta1().ClusterRoleBindings().Get(name, apiv1.GetOptions{})
-	case "statefulset":
+	case "rbac.authorization.k8s.io/v1/role":
+		_, err = kubeClient.RbacV1().Roles(namespace).Get(name, apiv1.GetOptions{})
+	case "rbac.authorization.k8s.io/v1/clusterrole":
+		_, err = kubeClient.RbacV1().ClusterRoles().Get(name, apiv1.GetOptions{})
+	case "rbac.authorization.k8s.io/v1/rolebinding":
+		_, err = kubeClient.RbacV1().RoleBindings(namespace).Get(name, apiv1.GetOptions{})
+	case "rbac.authorization.k8s.io/v1/clusterrolebinding":
+		_, err = kubeClient.RbacV1().ClusterRoleBindings().Get(name, apiv1.GetOptions{})
+	case "apps/v1beta1/statefulset":
 		_, err = kubeClient.AppsV1beta1().StatefulSets(namespace).Get(name, apiv1.GetOptions{})
+	case "apps/v1beta2/statefulset":
+		_, err = kubeClient.AppsV1beta2().StatefulSets(namespace).Get(name, apiv1.GetOptions{})
+	case "apps/v1/statefulset":
+		_, err = kubeClient.AppsV1().StatefulSets(namespace).Get(name, apiv1.GetOptions{})
 	default:
-		return false, UnsupportedResource(kind)
+		return checkGenericResourceExist(kubeClient, apiVersion, kind, name, namespace)
 	}
 	if err == nil {
 		return true, nil
@@ -152,48 +203,70 @@ func checkResourceExist(kubeClient *kubernetes.Clientset, kind, name, namespace
 	return false, err
 }
 
-func createResource(kubeClient *kubernetes.Clientset, kind, name, namespace string, resourceData interface{}) error {
+func createResource(kubeClient *KubeClient, apiVersion, kind, name, namespace string, resourceData interface{}) error {
 	var err error
 	retry := 0
 	for {
-		switch kind {
-		case "pod":
+		switch resourceKey(apiVersion, kind) {
+		case "v1/pod":
 			// Delete if possible
 			deleteOptions := apiv1.NewDeleteOptions(0)
 			kubeClient.Core().Pods(namespace).Delete(name, deleteOptions)
 			_, err = kubeClient.Core().Pods(namespace).Create(resourceData.(*v1.Pod))
-		case "deployment":
+		case "extensions/v1beta1/deployment":
 			_, err = kubeClient.Extensions().Deployments(namespace).Create(resourceData.(*v1beta1.Deployment))
-		case "service":
+		case "apps/v1beta1/deployment":
+			_, err = kubeClient.AppsV1beta1().Deployments(namespace).Create(resourceData.(*app.Deployment))
+		case "apps/v1beta2/deployment":
+			_, err = kubeClient.AppsV1beta2().Deployments(namespace).Create(resourceData.(*appsv1beta2.Deployment))
+		case "apps/v1/deployment":
+			_, err = kubeClient.AppsV1().Deployments(namespace).Create(resourceData.(*appsv1.Deployment))
+		case "v1/service":
 			_, err = kubeClient.Core().Services(namespace).Create(resourceData.(*v1.Service))
-		case "job":
+		case "batch/v1/job":
 			_, err = kubeClient.Batch().Jobs(namespace).Create(resourceData.(*v1batch.Job))
-		case "persistentvolumeclaim":
+		case "v1/persistentvolumeclaim":
 			_, err = kubeClient.Core().PersistentVolumeClaims(namespace).Create(resourceData.(*v1.PersistentVolumeClaim))
-		case "configmap":
+		case "v1/configmap":
 			_, err = kubeClient.Core().ConfigMaps(namespace).Create(resourceData.(*v1.ConfigMap))
-		case "secret":
+		case "v1/secret":
 			_, err = kubeClient.Core().Secrets(namespace).Create(resourceData.(*v1.Secret))
-		case "ingress":
+		case "extensions/v1beta1/ingress":
 			_, err = kubeClient.Extensions().Ingresses(namespace).Create(resourceData.(*v1beta1.Ingress))
-		case "endpoints":
+		case "v1/endpoints":
 			_, err = kubeClient.Core().Endpoints(namespace).Create(resourceData.(*v1.Endpoints))
-		case "daemonset":
+		case "extensions/v1beta1/daemonset":
 			_, err = kubeClient.Extensions().DaemonSets(namespace).Create(resourceData.(*v1beta1.DaemonSet))
-		case "serviceaccount":
+		case "apps/v1beta2/daemonset":
+			_, err = kubeClient.AppsV1beta2().DaemonSets(namespace).Create(resourceData.(*appsv1beta2.DaemonSet))
+		case "apps/v1/daemonset":
+			_, err = kubeClient.AppsV1().DaemonSets(namespace).Create(resourceData.(*appsv1.DaemonSet))
+		case "v1/serviceaccount":
 			_, err = kubeClient.Core().ServiceAccounts(namespace).Create(resourceData.(*v1.ServiceAccount))
-		case "role":
+		case "rbac.authorization.k8s.io/v1beta1/role":
 			_, err = kubeClient.RbacV1beta1().Roles(namespace).Create(resourceData.(*rbac.Role))
-		case "clusterrole":
+		case "rbac.authorization.k8s.io/v1beta1/clusterrole":
 			_, err = kubeClient.RbacV1beta1().ClusterRoles().Create(resourceData.(*rbac.ClusterRole))
-		case "rolebinding":
+		case "rbac.authorization.k8s.io/v1beta1/rolebinding":
 			_, err = kubeClient.RbacV1beta1().RoleBindings(namespace).Create(resourceData.(*rbac.RoleBinding))
-		case "clusterrolebinding":
+		case "rbac.authorization.k8s.io/v1beta1/clusterrolebinding":
 			_, err = kubeClient.RbacV1beta1().ClusterRoleBindings().Create(resourceData.(*rbac.ClusterRoleBinding))
-		case "statefulset":
+		case "rbac.authorization.k8s.io/v1/role":
+			_, err = kubeClient.RbacV1().Roles(namespace).Create(resourceData.(*rbacv1.Role))
+		case "rbac.authorization.k8s.io/v1/clusterrole":
+			_, err = kubeClient.RbacV1().ClusterRoles().Create(resourceData.(*rbacv1.ClusterRole))
+		case "rbac.authorization.k8s.io/v1/rolebinding":
+			_, err = kubeClient.RbacV1().RoleBindings(namespace).Create(resourceData.(*rbacv1.RoleBinding))
+		case "rbac.authorization.k8s.io/v1/clusterrolebinding":
+			_, err = kubeClient.RbacV1().ClusterRoleBindings().Create(resourceData.(*rbacv1.ClusterRoleBinding))
+		case "apps/v1beta1/statefulset":
 			_, err = kubeClient.AppsV1beta1().StatefulSets(namespace).Create(resourceData.(*app.StatefulSet))
+		case "apps/v1beta2/statefulset":
+			_, err = kubeClient.AppsV1beta2().StatefulSets(namespace).Create(resourceData.(*appsv1beta2.StatefulSet))
+		case "apps/v1/statefulset":
+			_, err = kubeClient.AppsV1().StatefulSets(namespace).Create(resourceData.(*appsv1.StatefulSet))
 		default:
-			return UnsupportedResource(kind)
+			err = createGenericResource(kubeClient, apiVersion, kind, namespace, resourceData)
 		}
 		if err == nil {
 			return nil
@@ -223,44 +296,66 @@ func createResource(kubeClient *kubernetes.Clientset, kind, name, namespace stri
 	return err
 }
 
-func destroyResource(kubeClient *kubernetes.Clientset, kind, name, namespace string) error {
+func destroyResource(kubeClient *KubeClient, apiVersion, kind, name, namespace string) error {
 	var err error
 	deleteOptions := apiv1.NewDeleteOptions(0)
-	switch kind {
-	case "pod":
+	switch resourceKey(apiVersion, kind) {
+	case "v1/pod":
 		return destroyPod(kubeClient, name, namespace)
-	case "deployment":
+	case "extensions/v1beta1/deployment":
 		return destroyDeployment(kubeClient, name, namespace)
-	case "service":
+	case "apps/v1beta1/deployment":
+		err = kubeClient.AppsV1beta1().Deployments(namespace).Delete(name, cascadingDeleteOptions())
+	case "apps/v1beta2/deployment":
+		err = kubeClient.AppsV1beta2().Deployments(namespace).Delete(name, cascadingDeleteOptions())
+	case "apps/v1/deployment":
+		err = kubeClient.AppsV1().Deployments(namespace).Delete(name, cascadingDeleteOptions())
+	case "v1/service":
 		err = kubeClient.Core().Services(namespace).Delete(name, deleteOptions)
-	case "job":
+	case "batch/v1/job":
 		return destroyJob(kubeClient, name, namespace)
-	case "persistentvolumeclaim":
+	case "v1/persistentvolumeclaim":
 		err = kubeClient.Core().PersistentVolumeClaims(namespace).Delete(name, deleteOptions)
-	case "configmap":
+	case "v1/configmap":
 		err = kubeClient.Core().ConfigMaps(namespace).Delete(name, deleteOptions)
-	case "secret":
+	case "v1/secret":
 		err = kubeClient.Core().Secrets(namespace).Delete(name, deleteOptions)
-	case "ingress":
+	case "extensions/v1beta1/ingress":
 		err = kubeClient.Extensions().Ingresses(namespace).Delete(name, deleteOptions)
-	case "endpoints":
+	case "v1/endpoints":
 		err = kubeClient.Core().Endpoints(namespace).Delete(name, deleteOptions)
-	case "daemonset":
+	case "extensions/v1beta1/daemonset":
 		err = destroyDaemonSet(kubeClient, name, namespace)
-	case "serviceaccount":
+	case "apps/v1beta2/daemonset":
+		err = kubeClient.AppsV1beta2().DaemonSets(namespace).Delete(name, cascadingDeleteOptions())
+	case "apps/v1/daemonset":
+		err = kubeClient.AppsV1().DaemonSets(namespace).Delete(name, cascadingDeleteOptions())
+	case "v1/serviceaccount":
 		err = kubeClient.Core().ServiceAccounts(namespace).Delete(name, deleteOptions)
-	case "role":
+	case "rbac.authorization.k8s.io/v1beta1/role":
 		err = kubeClient.RbacV1beta1().Roles(namespace).Delete(name, deleteOptions)
-	case "clusterrole":
+	case "rbac.authorization.k8s.io/v1beta1/clusterrole":
 		err = kubeClient.RbacV1beta1().ClusterRoles().Delete(name, deleteOptions)
-	case "rolebinding":
+	case "rbac.authorization.k8s.io/v1beta1/rolebinding":
 		err = kubeClient.RbacV1beta1().RoleBindings(namespace).Delete(name, deleteOptions)
-	case "clusterrolebinding":
+	case "rbac.authorization.k8s.io/v1beta1/clusterrolebinding":
 		err = kubeClient.RbacV1beta1().ClusterRoleBindings().Delete(name, deleteOptions)
-	case "statefulset":
+	case "rbac.authorization.k8s.io/v1/role":
+		err = kubeClient.RbacV1().Roles(namespace).Delete(name, deleteOptions)
+	case "rbac.authorization.k8s.io/v1/clusterrole":
+		err = kubeClient.RbacV1().ClusterRoles().Delete(name, deleteOptions)
+	case "rbac.authorization.k8s.io/v1/rolebinding":
+		err = kubeClient.RbacV1().RoleBindings(namespace).Delete(name, deleteOptions)
+	case "rbac.authorization.k8s.io/v1/clusterrolebinding":
+		err = kubeClient.RbacV1().ClusterRoleBindings().Delete(name, deleteOptions)
+	case "apps/v1beta1/statefulset":
 		err = destroyStatefulSet(kubeClient, name, namespace)
+	case "apps/v1beta2/statefulset":
+		err = kubeClient.AppsV1beta2().StatefulSets(namespace).Delete(name, cascadingDeleteOptions())
+	case "apps/v1/statefulset":
+		err = kubeClient.AppsV1().StatefulSets(namespace).Delete(name, cascadingDeleteOptions())
 	default:
-		return UnsupportedResource(kind)
+		err = destroyGenericResource(kubeClient, apiVersion, kind, name, namespace)
 	}
 	statusErr, ok := err.(*errors.StatusError)
 	if !ok {
@@ -272,62 +367,223 @@ func destroyResource(kubeClient *kubernetes.Clientset, kind, name, namespace str
 	return err
 }
 
-func updateResource(kubeClient *kubernetes.Clientset, kind, name, namespace string, resourceData interface{}) error {
+func isRecreatedKind(apiVersion, kind string) bool {
+	key := resourceKey(apiVersion, kind)
+	return key == "batch/v1/job" || key == "v1/pod"
+}
+
+func updateResource(kubeClient *KubeClient, apiVersion, kind, name, namespace string, resourceData interface{}) error {
 	var err error
-	switch kind {
-	case "pod":
-		_, err = kubeClient.Core().Pods(namespace).Update(resourceData.(*v1.Pod))
-	case "deployment":
+	switch resourceKey(apiVersion, kind) {
+	case "v1/pod":
+		return recreatePod(kubeClient, name, namespace, resourceData.(*v1.Pod))
+	case "extensions/v1beta1/deployment":
 		_, err = kubeClient.Extensions().Deployments(namespace).Update(resourceData.(*v1beta1.Deployment))
-	case "service":
-		return nil
-	case "job":
-		return nil
-	case "persistentvolumeclaim":
-		return nil
-	case "configmap":
+	case "apps/v1beta1/deployment":
+		_, err = kubeClient.AppsV1beta1().Deployments(namespace).Update(resourceData.(*app.Deployment))
+	case "apps/v1beta2/deployment":
+		_, err = kubeClient.AppsV1beta2().Deployments(namespace).Update(resourceData.(*appsv1beta2.Deployment))
+	case "apps/v1/deployment":
+		_, err = kubeClient.AppsV1().Deployments(namespace).Update(resourceData.(*appsv1.Deployment))
+	case "v1/service":
+		return updateService(kubeClient, name, namespace, resourceData.(*v1.Service))
+	case "batch/v1/job":
+		return recreateJob(kubeClient, name, namespace, resourceData.(*v1batch.Job))
+	case "v1/persistentvolumeclaim":
+		return resizePersistentVolumeClaim(kubeClient, name, namespace, resourceData.(*v1.PersistentVolumeClaim))
+	case "v1/configmap":
 		_, err = kubeClient.Core().ConfigMaps(namespace).Update(resourceData.(*v1.ConfigMap))
-	case "secret":
+	case "v1/secret":
 		_, err = kubeClient.Core().Secrets(namespace).Update(resourceData.(*v1.Secret))
-	case "ingress":
+	case "extensions/v1beta1/ingress":
 		_, err = kubeClient.Extensions().Ingresses(namespace).Update(resourceData.(*v1beta1.Ingress))
-	case "endpoints":
+	case "v1/endpoints":
 		_, err = kubeClient.Core().Endpoints(namespace).Update(resourceData.(*v1.Endpoints))
-	case "daemonset":
+	case "extensions/v1beta1/daemonset":
 		_, err = kubeClient.Extensions().DaemonSets(namespace).Update(resourceData.(*v1beta1.DaemonSet))
-	case "serviceaccount":
+	case "apps/v1beta2/daemonset":
+		_, err = kubeClient.AppsV1beta2().DaemonSets(namespace).Update(resourceData.(*appsv1beta2.DaemonSet))
+	case "apps/v1/daemonset":
+		_, err = kubeClient.AppsV1().DaemonSets(namespace).Update(resourceData.(*appsv1.DaemonSet))
+	case "v1/serviceaccount":
 		_, err = kubeClient.Core().ServiceAccounts(namespace).Update(resourceData.(*v1.ServiceAccount))
-	case "role":
+	case "rbac.authorization.k8s.io/v1beta1/role":
 		_, err = kubeClient.RbacV1beta1().Roles(namespace).Update(resourceData.(*rbac.Role))
-	case "clusterrole":
+	case "rbac.authorization.k8s.io/v1beta1/clusterrole":
 		_, err = kubeClient.RbacV1beta1().ClusterRoles().Update(resourceData.(*rbac.ClusterRole))
-	case "rolebinding":
+	case "rbac.authorization.k8s.io/v1beta1/rolebinding":
 		_, err = kubeClient.RbacV1beta1().RoleBindings(namespace).Update(resourceData.(*rbac.RoleBinding))
-	case "clusterrolebinding":
+	case "rbac.authorization.k8s.io/v1beta1/clusterrolebinding":
 		_, err = kubeClient.RbacV1beta1().ClusterRoleBindings().Update(resourceData.(*rbac.ClusterRoleBinding))
-	case "statefulset":
+	case "rbac.authorization.k8s.io/v1/role":
+		_, err = kubeClient.RbacV1().Roles(namespace).Update(resourceData.(*rbacv1.Role))
+	case "rbac.authorization.k8s.io/v1/clusterrole":
+		_, err = kubeClient.RbacV1().ClusterRoles().Update(resourceData.(*rbacv1.ClusterRole))
+	case "rbac.authorization.k8s.io/v1/rolebinding":
+		_, err = kubeClient.RbacV1().RoleBindings(namespace).Update(resourceData.(*rbacv1.RoleBinding))
+	case "rbac.authorization.k8s.io/v1/clusterrolebinding":
+		_, err = kubeClient.RbacV1().ClusterRoleBindings().Update(resourceData.(*rbacv1.ClusterRoleBinding))
+	case "apps/v1beta1/statefulset":
 		_, err = kubeClient.AppsV1beta1().StatefulSets(namespace).Update(resourceData.(*app.StatefulSet))
+	case "apps/v1beta2/statefulset":
+		_, err = kubeClient.AppsV1beta2().StatefulSets(namespace).Update(resourceData.(*appsv1beta2.StatefulSet))
+	case "apps/v1/statefulset":
+		_, err = kubeClient.AppsV1().StatefulSets(namespace).Update(resourceData.(*appsv1.StatefulSet))
 	default:
-		return UnsupportedResource(kind)
+		return updateGenericResource(kubeClient, apiVersion, kind, name, namespace, resourceData)
+	}
+	return err
+}
+
+// updateService keeps the allocated cluster ip and node ports, which cannot be
+// changed or would be reallocated by a plain update
+func updateService(kubeClient *KubeClient, name, namespace string, service *v1.Service) error {
+	current, err := kubeClient.Core().Services(namespace).Get(name, apiv1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	service = service.DeepCopy()
+	service.ResourceVersion = current.ResourceVersion
+	if service.Spec.ClusterIP == "" {
+		service.Spec.ClusterIP = current.Spec.ClusterIP
+	}
+	for i, port := range service.Spec.Ports {
+		if port.NodePort != 0 {
+			continue
+		}
+		for _, currentPort := range current.Spec.Ports {
+			if currentPort.Port == port.Port {
+				service.Spec.Ports[i].NodePort = currentPort.NodePort
+				break
+			}
+		}
+	}
+	_, err = kubeClient.Core().Services(namespace).Update(service)
+	return err
+}
+
+// recreateJob replaces a job whose spec changed, since the pod template of a
+// job is immutable
+func recreateJob(kubeClient *KubeClient, name, namespace string, job *v1batch.Job) error {
+	current, err := kubeClient.Batch().Jobs(namespace).Get(name, apiv1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	changed, err := resourceChanged(job, current)
+	if err != nil || !changed {
+		return err
+	}
+	err = destroyJob(kubeClient, name, namespace)
+	if err != nil {
+		return err
+	}
+	retry := 0
+	for {
+		_, err = kubeClient.Batch().Jobs(namespace).Create(job)
+		if err == nil || !errors.IsAlreadyExists(err) {
+			return err
+		}
+		// The old job is still being deleted
+		retry++
+		if retry > 30 {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// recreatePod replaces a changed pod, most of the pod spec is immutable
+func recreatePod(kubeClient *KubeClient, name, namespace string, pod *v1.Pod) error {
+	current, err := kubeClient.Core().Pods(namespace).Get(name, apiv1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	changed, err := resourceChanged(pod, current)
+	if err != nil || !changed {
+		return err
 	}
+	err = destroyPod(kubeClient, name, namespace)
+	if err != nil {
+		return err
+	}
+	retry := 0
+	for {
+		_, err = kubeClient.Core().Pods(namespace).Create(pod)
+		if err == nil || !errors.IsAlreadyExists(err) {
+			return err
+		}
+		// The old pod is still terminating
+		retry++
+		if retry > 30 {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// resizePersistentVolumeClaim only patches the requested storage, the rest of
+// the claim spec is immutable once bound
+func resizePersistentVolumeClaim(kubeClient *KubeClient, name, namespace string, claim *v1.PersistentVolumeClaim) error {
+	desiredSize, ok := claim.Spec.Resources.Requests[v1.ResourceStorage]
+	if !ok {
+		return nil
+	}
+	current, err := kubeClient.Core().PersistentVolumeClaims(namespace).Get(name, apiv1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	currentSize := current.Spec.Resources.Requests[v1.ResourceStorage]
+	switch desiredSize.Cmp(currentSize) {
+	case 0:
+		return nil
+	case -1:
+		return fmt.Errorf("cannot shrink persistent volume claim %q from %s to %s", name, currentSize.String(), desiredSize.String())
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"resources": map[string]interface{}{
+				"requests": map[string]interface{}{
+					string(v1.ResourceStorage): desiredSize.String(),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = kubeClient.Core().PersistentVolumeClaims(namespace).Patch(name, types.StrategicMergePatchType, patch)
 	return err
 }
 
 func getResourceImages(kind string, resourceData interface{}) ([]string, error) {
 	var containers []v1.Container
-	switch kind {
-	case "pod":
-		containers = resourceData.(*v1.Pod).Spec.Containers
-	case "deployment":
-		containers = resourceData.(*v1beta1.Deployment).Spec.Template.Spec.Containers
-	case "job":
-		containers = resourceData.(*v1batch.Job).Spec.Template.Spec.Containers
-	case "daemonset":
-		containers = resourceData.(*v1beta1.DaemonSet).Spec.Template.Spec.Containers
-	case "service", "persistentvolumeclaim", "configmap", "secret", "ingress", "endpoints", "serviceaccount", "role", "clusterrole", "rolebinding", "clusterrolebinding", "statefulset":
-		return nil, nil
-	default:
-		return nil, UnsupportedResource(kind)
+	switch resource := resourceData.(type) {
+	case *v1.Pod:
+		containers = resource.Spec.Containers
+	case *v1beta1.Deployment:
+		containers = resource.Spec.Template.Spec.Containers
+	case *app.Deployment:
+		containers = resource.Spec.Template.Spec.Containers
+	case *appsv1beta2.Deployment:
+		containers = resource.Spec.Template.Spec.Containers
+	case *appsv1.Deployment:
+		containers = resource.Spec.Template.Spec.Containers
+	case *v1batch.Job:
+		containers = resource.Spec.Template.Spec.Containers
+	case *v1beta1.DaemonSet:
+		containers = resource.Spec.Template.Spec.Containers
+	case *appsv1beta2.DaemonSet:
+		containers = resource.Spec.Template.Spec.Containers
+	case *appsv1.DaemonSet:
+		containers = resource.Spec.Template.Spec.Containers
+	case *app.StatefulSet:
+		containers = resource.Spec.Template.Spec.Containers
+	case *appsv1beta2.StatefulSet:
+		containers = resource.Spec.Template.Spec.Containers
+	case *appsv1.StatefulSet:
+		containers = resource.Spec.Template.Spec.Containers
+	case *unstructured.Unstructured:
+		return getGenericResourceImages(kind, resource)
 	}
 	images := []string{}
 	for _, container := range containers {
@@ -336,7 +592,16 @@ func getResourceImages(kind string, resourceData interface{}) ([]string, error)
 	return images, nil
 }
 
-func destroyPod(kubeClient *kubernetes.Clientset, name, namespace string) error {
+// cascadingDeleteOptions lets the garbage collector remove the replica sets
+// and pods owned by the deleted object
+func cascadingDeleteOptions() *apiv1.DeleteOptions {
+	deleteOptions := apiv1.NewDeleteOptions(0)
+	propagationPolicy := apiv1.DeletePropagationBackground
+	deleteOptions.PropagationPolicy = &propagationPolicy
+	return deleteOptions
+}
+
+func destroyPod(kubeClient *KubeClient, name, namespace string) error {
 	deleteOptions := apiv1.NewDeleteOptions(0)
 	err := kubeClient.Core().Pods(namespace).Delete(name, deleteOptions)
 	if err == nil {
@@ -352,7 +617,7 @@ func destroyPod(kubeClient *kubernetes.Clientset, name, namespace string) error
 	return err
 }
 
-func destroyDeployment(kubeClient *kubernetes.Clientset, name, namespace string) error {
+func destroyDeployment(kubeClient *KubeClient, name, namespace string) error {
 	deleteOptions := apiv1.NewDeleteOptions(0)
 	err := kubeClient.Extensions().Deployments(namespace).Delete(name, deleteOptions)
 	if err != nil {
@@ -368,7 +633,7 @@ func destroyDeployment(kubeClient *kubernetes.Clientset, name, namespace string)
 	return kubeClient.Core().Pods(namespace).DeleteCollection(deleteOptions, listOptions)
 }
 
-func destroyDaemonSet(kubeClient *kubernetes.Clientset, name, namespace string) error {
+func destroyDaemonSet(kubeClient *KubeClient, name, namespace string) error {
 	deleteOptions := apiv1.NewDeleteOptions(0)
 	err := kubeClient.Extensions().DaemonSets(namespace).Delete(name, deleteOptions)
 	if err != nil {
@@ -384,7 +649,7 @@ func destroyDaemonSet(kubeClient *kubernetes.Clientset, name, namespace string)
 	return kubeClient.Core().Pods(namespace).DeleteCollection(deleteOptions, listOptions)
 }
 
-func destroyStatefulSet(kubeClient *kubernetes.Clientset, name, namespace string) error {
+func destroyStatefulSet(kubeClient *KubeClient, name, namespace string) error {
 	deleteOptions := apiv1.NewDeleteOptions(0)
 	err := kubeClient.AppsV1beta1().StatefulSets(namespace).Delete(name, deleteOptions)
 	if err != nil {
@@ -400,7 +665,7 @@ func destroyStatefulSet(kubeClient *kubernetes.Clientset, name, namespace string
 	return kubeClient.Core().Pods(namespace).DeleteCollection(deleteOptions, listOptions)
 }
 
-func destroyJob(kubeClient *kubernetes.Clientset, name, namespace string) error {
+func destroyJob(kubeClient *KubeClient, name, namespace string) error {
 	deleteOptions := apiv1.NewDeleteOptions(0)
 	err := kubeClient.Batch().Jobs(namespace).Delete(name, deleteOptions)
 	if err != nil {
@@ -421,13 +686,11 @@ func destroyJob(kubeClient *kubernetes.Clientset, name, namespace string) error
 	return nil
 }
 
-func getLogFromPod(kubeClient *kubernetes.Clientset, namespace, podName string, follow bool) (io.ReadCloser, error) {
+func getLogFromPod(kubeClient *KubeClient, namespace, podName string, options *v1.PodLogOptions) (io.ReadCloser, error) {
 	var stream io.ReadCloser
 	var err error
 	for {
-		stream, err = kubeClient.Core().Pods(namespace).GetLogs(podName, &v1.PodLogOptions{
-			Follow: follow,
-		}).Stream()
+		stream, err = kubeClient.Core().Pods(namespace).GetLogs(podName, options).Stream()
 		if err == nil {
 			break
 		}
@@ -440,7 +703,7 @@ func getLogFromPod(kubeClient *kubernetes.Clientset, namespace, podName string,
 	return stream, nil
 }
 
-func getEvents(kubeClient *kubernetes.Clientset, namespace, podName string) ([]v1.Event, error) {
+func getEvents(kubeClient *KubeClient, namespace, podName string) ([]v1.Event, error) {
 	events, err := kubeClient.Core().Events(namespace).List(apiv1.ListOptions{
 		FieldSelector: "involvedObject.name=" + podName,
 	})
@@ -450,7 +713,7 @@ func getEvents(kubeClient *kubernetes.Clientset, namespace, podName string) ([]v
 	return events.Items, err
 }
 
-func getLastEvent(kubeClient *kubernetes.Clientset, namespace, podName string) (*v1.Event, error) {
+func getLastEvent(kubeClient *KubeClient, namespace, podName string) (*v1.Event, error) {
 	events, err := getEvents(kubeClient, namespace, podName)
 	if err != nil {
 		return nil, err
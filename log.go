@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1batch "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// logCursor remembers how far a container log was read. The api server only
+// resumes a log from a whole second, so the lines of the last second already
+// printed are remembered to drop them when they are sent again.
+type logCursor struct {
+	last time.Time
+	seen map[string]struct{}
+}
+
+// sinceTime is where to resume the log stream, nil to read it from the start
+func (c *logCursor) sinceTime() *apiv1.Time {
+	if c.last.IsZero() {
+		return nil
+	}
+	since := apiv1.NewTime(c.last)
+	return &since
+}
+
+// accept strips the timestamp of a log line and reports whether the line is
+// new
+func (c *logCursor) accept(line string) (string, bool) {
+	pieces := strings.SplitN(line, " ", 2)
+	timestamp, err := time.Parse(time.RFC3339Nano, pieces[0])
+	if err != nil || len(pieces) != 2 {
+		return line, true
+	}
+	if timestamp.Before(c.last) {
+		return "", false
+	}
+	if c.seen == nil || !timestamp.Truncate(time.Second).Equal(c.last.Truncate(time.Second)) {
+		c.seen = make(map[string]struct{})
+	}
+	_, seen := c.seen[line]
+	if seen {
+		return "", false
+	}
+	c.seen[line] = struct{}{}
+	c.last = timestamp
+	return pieces[1], true
+}
+
+// followPodLog prints the log of a container until its pod terminates. The
+// stream is reopened whenever it breaks or the container restarts, without
+// losing or repeating lines.
+func followPodLog(kubeClient *KubeClient, namespace, podName, container string, printLine func(line string)) error {
+	cursor := &logCursor{}
+	for {
+		pod, err := waitPodStarted(kubeClient, namespace, podName)
+		if err != nil {
+			return err
+		}
+		stream, err := getLogFromPod(kubeClient, namespace, podName, &v1.PodLogOptions{
+			Container:  container,
+			Follow:     true,
+			Timestamps: true,
+			SinceTime:  cursor.sinceTime(),
+		})
+		if err != nil {
+			return err
+		}
+		err = readLogLines(stream, cursor, printLine)
+		stream.Close()
+		if err != nil {
+			ErrPrintln(ColorRed, "Log stream interrupted: ", err)
+		}
+		if isPodTerminated(pod) {
+			return nil
+		}
+		pod, err = kubeClient.Core().Pods(namespace).Get(podName, apiv1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if isPodTerminated(pod) {
+			// Lines written between the end of the stream and the end of the
+			// pod are read by one last pass
+			continue
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func readLogLines(stream io.Reader, cursor *logCursor, printLine func(line string)) error {
+	reader := bufio.NewReader(stream)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			text, ok := cursor.accept(strings.TrimSuffix(line, "\n"))
+			if ok {
+				printLine(text)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// waitPodStarted waits for the pod to leave the pending phase, when its log
+// can be read
+func waitPodStarted(kubeClient *KubeClient, namespace, podName string) (*v1.Pod, error) {
+	for {
+		pod, err := kubeClient.Core().Pods(namespace).Get(podName, apiv1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if pod.Status.Phase != v1.PodPending {
+			return pod, nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func isPodTerminated(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
+
+// logAggregator follows the log of every container of the pods matching a
+// set of label selectors, including the pods created while it runs
+type logAggregator struct {
+	kubeClient *KubeClient
+	namespace  string
+	selectors  []string
+	followed   map[string]struct{}
+}
+
+func newLogAggregator(kubeClient *KubeClient, namespace string, selectors []string) *logAggregator {
+	return &logAggregator{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		selectors:  selectors,
+		followed:   make(map[string]struct{}),
+	}
+}
+
+// run looks for new pods every few seconds until interrupted
+func (a *logAggregator) run() error {
+	for {
+		err := a.followNewPods()
+		if err != nil {
+			return err
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (a *logAggregator) followNewPods() error {
+	for _, selector := range a.selectors {
+		pods, err := a.kubeClient.Core().Pods(a.namespace).List(apiv1.ListOptions{
+			LabelSelector: selector,
+		})
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods.Items {
+			for _, container := range pod.Spec.Containers {
+				prefix := pod.Name + "/" + container.Name
+				_, ok := a.followed[prefix]
+				if ok {
+					continue
+				}
+				color := PrefixColor(len(a.followed))
+				a.followed[prefix] = struct{}{}
+				go a.follow(pod.Name, container.Name, prefix, color)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *logAggregator) follow(podName, container, prefix string, color Color) {
+	err := followPodLog(a.kubeClient, a.namespace, podName, container, func(line string) {
+		PrintPrefixed(color, prefix, line)
+	})
+	if err != nil && !isResourceNotExist(err) {
+		ErrPrintf(ColorRed, "%s: %s\n", prefix, err)
+	}
+}
+
+// podSelectors derives, from the pod templates of the project assets, the
+// label selectors matching the pods of the project
+func (p *Project) podSelectors() ([]string, error) {
+	selectors := []string{}
+	seen := make(map[string]struct{})
+	for _, asset := range p.allAssets() {
+		object, err := toUnstructuredMap(asset.ResourceData)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range podSpecPaths {
+			_, found, _ := unstructured.NestedSlice(object, append(path, "containers")...)
+			if !found {
+				continue
+			}
+			// The pod metadata sits next to the pod spec
+			metadataPath := append(append([]string{}, path[:len(path)-1]...), "metadata", "labels")
+			podLabels, _, _ := unstructured.NestedStringMap(object, metadataPath...)
+			if len(podLabels) == 0 {
+				// An empty selector would match every pod of the namespace
+				continue
+			}
+			selector := labels.SelectorFromSet(podLabels).String()
+			_, duplicated := seen[selector]
+			if !duplicated {
+				seen[selector] = struct{}{}
+				selectors = append(selectors, selector)
+			}
+		}
+	}
+	return selectors, nil
+}
+
+// followPodContainers follows every container of a pod at once, prefixing
+// the lines only when there is more than one container
+func followPodContainers(kubeClient *KubeClient, namespace string, pod *v1.Pod) error {
+	if len(pod.Spec.Containers) == 1 {
+		return followPodLog(kubeClient, namespace, pod.Name, pod.Spec.Containers[0].Name, func(line string) {
+			fmt.Println(line)
+		})
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(pod.Spec.Containers))
+	for i, container := range pod.Spec.Containers {
+		wg.Add(1)
+		go func(container string, color Color) {
+			defer wg.Done()
+			prefix := pod.Name + "/" + container
+			errs <- followPodLog(kubeClient, namespace, pod.Name, container, func(line string) {
+				PrintPrefixed(color, prefix, line)
+			})
+		}(container.Name, PrefixColor(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// podExitCode returns the first non zero exit code of the terminated
+// containers of a pod, it reports false when no container terminated
+func podExitCode(pod *v1.Pod) (int, bool) {
+	exitCode := 0
+	terminated := false
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		state := containerStatus.State.Terminated
+		if state == nil {
+			state = containerStatus.LastTerminationState.Terminated
+		}
+		if state == nil {
+			continue
+		}
+		terminated = true
+		if exitCode == 0 {
+			exitCode = int(state.ExitCode)
+		}
+	}
+	return exitCode, terminated
+}
+
+// followJobLog follows the pods of a job one after the other, including the
+// ones created to retry a failure, and returns the exit code of the job
+func followJobLog(kubeClient *KubeClient, namespace, jobName string) (int, error) {
+	followed := make(map[string]struct{})
+	exitCode := 0
+	for {
+		job, err := kubeClient.Batch().Jobs(namespace).Get(jobName, apiv1.GetOptions{})
+		if err != nil {
+			return 0, err
+		}
+		pods, err := kubeClient.Core().Pods(namespace).List(apiv1.ListOptions{
+			LabelSelector: "job-name=" + jobName,
+		})
+		if err != nil {
+			return 0, err
+		}
+		sort.SliceStable(pods.Items, func(i, j int) bool {
+			return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+		})
+		newPod := false
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			_, ok := followed[pod.Name]
+			if ok {
+				continue
+			}
+			followed[pod.Name] = struct{}{}
+			newPod = true
+			err = followPodContainers(kubeClient, namespace, pod)
+			if err != nil && !isResourceNotExist(err) {
+				return 0, err
+			}
+			pod, err = kubeClient.Core().Pods(namespace).Get(pod.Name, apiv1.GetOptions{})
+			if err != nil {
+				if isResourceNotExist(err) {
+					continue
+				}
+				return 0, err
+			}
+			code, terminated := podExitCode(pod)
+			if terminated {
+				exitCode = code
+			}
+			if pod.Status.Phase == v1.PodFailed {
+				ErrPrintf(ColorYellow, "Pod %q failed with exit code %d\n", pod.Name, code)
+			}
+		}
+		complete, failed := jobFinished(job)
+		switch {
+		case complete:
+			return 0, nil
+		case failed && !newPod:
+			if exitCode == 0 {
+				exitCode = 1
+			}
+			return exitCode, nil
+		case !newPod:
+			time.Sleep(2 * time.Second)
+		}
+	}
+}
+
+// jobFinished reports whether a job completed or failed, looking at all its
+// conditions since the one telling how it ended is not always the first
+func jobFinished(job *v1batch.Job) (bool, bool) {
+	complete := false
+	failed := false
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case v1batch.JobComplete:
+			complete = true
+		case v1batch.JobFailed:
+			failed = true
+		}
+	}
+	return complete, failed
+}
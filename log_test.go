@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1batch "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+)
+
+func TestLogCursorResume(t *testing.T) {
+	req := require.New(t)
+	cursor := &logCursor{}
+	lines := []string{}
+	printLine := func(line string) {
+		lines = append(lines, line)
+	}
+	req.Nil(cursor.sinceTime())
+
+	err := readLogLines(strings.NewReader(
+		"2018-03-01T10:00:00.100000000Z first\n"+
+			"2018-03-01T10:00:01.200000000Z second\n"+
+			"2018-03-01T10:00:01.300000000Z third\n"), cursor, printLine)
+	req.NoError(err)
+	req.Equal("2018-03-01T10:00:01Z", cursor.sinceTime().UTC().Format("2006-01-02T15:04:05Z07:00"))
+
+	// The api server resumes from the start of the second
+	err = readLogLines(strings.NewReader(
+		"2018-03-01T10:00:01.200000000Z second\n"+
+			"2018-03-01T10:00:01.300000000Z third\n"+
+			"2018-03-01T10:00:01.300000000Z fourth\n"+
+			"2018-03-01T10:00:02.000000000Z fifth"), cursor, printLine)
+	req.NoError(err)
+	req.Equal([]string{"first", "second", "third", "fourth", "fifth"}, lines)
+}
+
+func TestProjectPodSelectors(t *testing.T) {
+	req := require.New(t)
+	config := &appConfig{}
+	project, err := readProject(nil, "test-assets/config-tests/multi-document", config)
+	req.NoError(err)
+	selectors, err := project.podSelectors()
+	req.NoError(err)
+	req.Equal([]string{"name=app"}, selectors)
+}
+
+func TestPodExitCode(t *testing.T) {
+	req := require.New(t)
+	pod := &v1.Pod{}
+	_, terminated := podExitCode(pod)
+	req.False(terminated)
+
+	pod.Status.ContainerStatuses = []v1.ContainerStatus{
+		{Name: "sidecar", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+		{Name: "app", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 3}}},
+	}
+	exitCode, terminated := podExitCode(pod)
+	req.True(terminated)
+	req.Equal(3, exitCode)
+}
+
+func TestJobFinished(t *testing.T) {
+	req := require.New(t)
+	job := &v1batch.Job{}
+	job.Status.Conditions = []v1batch.JobCondition{
+		{Type: v1batch.JobFailed, Status: v1.ConditionFalse},
+		{Type: v1batch.JobComplete, Status: v1.ConditionTrue},
+	}
+	complete, failed := jobFinished(job)
+	req.True(complete)
+	req.False(failed)
+}
@@ -10,11 +10,18 @@ import (
 )
 
 type appConfig struct {
-	configFile string
-	context    string
-	namespace  string
-	timeout    time.Duration
-	variables  variableMap
+	configFile    string
+	context       string
+	namespace     string
+	timeout       time.Duration
+	parallel      int
+	buildParallel int
+	buildTags     buildTagMode
+	output        string
+	dryRun        bool
+	environment   string
+	variables     variableMap
+	variableFiles stringList
 }
 
 type variableMap map[string]string
@@ -25,20 +32,26 @@ func (v *variableMap) String() string {
 
 func (v *variableMap) Set(value string) error {
 	pieces := strings.SplitN(value, "=", 2)
-	if len(pieces) != 2 {
-		return nil
+	if len(pieces) != 2 || pieces[0] == "" {
+		return fmt.Errorf("invalid variable %q, expected key=value", value)
 	}
 	(*v)[pieces[0]] = pieces[1]
 	return nil
 }
 
+// stringList collects the values of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func main() {
-	// check docker command
-	err := checkDockerCommand()
-	if err != nil {
-		ErrPrintln(ColorRed, "docker command not found, please install docker command line")
-		os.Exit(1)
-	}
 	config := &appConfig{
 		variables: make(variableMap),
 	}
@@ -46,9 +59,24 @@ func main() {
 	flag.StringVar(&config.context, "context", "", "Kube context")
 	flag.StringVar(&config.namespace, "namespace", "", "Kube namespace")
 	flag.DurationVar(&config.timeout, "timeout", 15*time.Minute, "timeout duration")
-	flag.Var(&config.variables, "variable", "override variables")
+	flag.IntVar(&config.parallel, "parallel", 1, "maximum number of assets deployed at the same time")
+	flag.IntVar(&config.buildParallel, "build-parallel", 1, "maximum number of images built at the same time")
+	flag.StringVar(&config.output, "output", "text", "output format, text or json")
+	flag.BoolVar(&config.dryRun, "dry-run", false, "only print, and validate when the cluster supports it, what would be done")
+	flag.StringVar(&config.environment, "env", "", "environment of project.yml to use")
+	flag.Var(&config.variables, "variable", "override variables, as key=value")
+	flag.Var(&config.variableFiles, "variable-file", "yaml file of variables, can be repeated")
 	flag.Parse()
 
+	switch config.output {
+	case "text":
+	case "json":
+		enableJSONOutput()
+	default:
+		ErrPrintf(ColorRed, "Unknown output format %q\n", config.output)
+		printUsage()
+	}
+
 	if config.configFile == "" {
 		config.configFile = filepath.Join(os.Getenv("HOME"), ".kube", "config")
 	}
@@ -70,6 +98,12 @@ func main() {
 		cmdDownJobs(args[1:], config)
 	case "update":
 		cmdUpdate(args[1:], config)
+	case "plan":
+		cmdPlan(args[1:], config)
+	case "apply":
+		cmdApply(args[1:], config)
+	case "prune":
+		cmdPrune(args[1:], config)
 	case "wait":
 		cmdWait(args[1:], config)
 	case "log":
@@ -82,6 +116,12 @@ func main() {
 		cmdAutoUpdate(args[1:], config)
 	case "debug":
 		cmdDebug(args[1:], config)
+	case "render":
+		cmdRender(args[1:], config)
+	case "vars":
+		cmdVars(args[1:], config)
+	case "secret":
+		cmdSecret(args[1:], config)
 	default:
 		printUsage()
 	}
@@ -89,7 +129,7 @@ func main() {
 
 func printUsage() {
 	ErrPrintf(ColorWhite, "USAGE: %s <flag> [command] <folder>\n", os.Args[0])
-	ErrPrintf(ColorWhite, "Available commands: up, down, update, version, wait, log, data, generate\n")
+	ErrPrintf(ColorWhite, "Available commands: up, apply, down, update, plan, prune, version, wait, log, data, generate, render, vars, secret\n")
 	flag.PrintDefaults()
 	os.Exit(2)
 }
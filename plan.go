@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type PlanAction string
+
+const (
+	PlanCreate    PlanAction = "create"
+	PlanUpdate    PlanAction = "update"
+	PlanUnchanged PlanAction = "unchanged"
+	PlanOrphan    PlanAction = "delete-orphan"
+)
+
+type PlanEntry struct {
+	Action  PlanAction
+	Kind    string
+	Name    string
+	Asset   *Asset
+	Changes []*FieldChange
+}
+
+type FieldChange struct {
+	Path    string
+	Current interface{}
+	Desired interface{}
+}
+
+// ignoredPlanPaths are fields owned by the cluster rather than by the assets
+var ignoredPlanPaths = map[string]struct{}{
+	"status": {},
+}
+
+func (p *Project) Plan() error {
+	entries, err := p.computePlan()
+	if err != nil {
+		return err
+	}
+	Printf(ColorYellow, "Planning project %q in namespace %q\n", p.projectConfig.Name, p.projectConfig.Namespace)
+	if p.defaultName {
+		Printf(ColorYellow, "Orphans are not listed, the project has no name in project.yml\n")
+	}
+	counts := make(map[PlanAction]int)
+	for _, entry := range entries {
+		counts[entry.Action]++
+		switch entry.Action {
+		case PlanCreate:
+			Printf(ColorGreen, "====> create %s %q\n", entry.Kind, entry.Name)
+		case PlanUpdate:
+			Printf(ColorYellow, "====> update %s %q\n", entry.Kind, entry.Name)
+			for _, change := range entry.Changes {
+				Printf(ColorWhite, "        %s: %s => %s\n", change.Path, formatPlanValue(change.Current), formatPlanValue(change.Desired))
+			}
+		case PlanUnchanged:
+			Printf(ColorWhite, "====> unchanged %s %q\n", entry.Kind, entry.Name)
+		case PlanOrphan:
+			Printf(ColorRed, "====> delete-orphan %s %q\n", entry.Kind, entry.Name)
+		}
+	}
+	Printf(ColorGreen, "Plan: %d to create, %d to update, %d unchanged, %d orphaned\n", counts[PlanCreate], counts[PlanUpdate], counts[PlanUnchanged], counts[PlanOrphan])
+	return nil
+}
+
+func (p *Project) computePlan() ([]*PlanEntry, error) {
+	entries := []*PlanEntry{}
+	for _, asset := range p.allAssets() {
+		entry, err := p.planAsset(asset)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if p.defaultName {
+		// Orphans are only looked up for named projects, see checkPruneName
+		return entries, nil
+	}
+	orphans, err := p.findOrphans()
+	if err != nil {
+		return nil, err
+	}
+	for _, orphan := range orphans {
+		entries = append(entries, &PlanEntry{
+			Action: PlanOrphan,
+			Kind:   strings.ToLower(orphan.GetKind()),
+			Name:   orphan.GetName(),
+		})
+	}
+	return entries, nil
+}
+
+func (p *Project) planAsset(asset *Asset) (*PlanEntry, error) {
+	objectMeta := asset.ResourceData.(Meta)
+	entry := &PlanEntry{
+		Kind:  asset.Kind,
+		Name:  objectMeta.GetName(),
+		Asset: asset,
+	}
+	existed, err := checkResourceExist(p.kubeClient, asset.APIVersion, asset.Kind, entry.Name, p.projectConfig.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !existed {
+		entry.Action = PlanCreate
+		return entry, nil
+	}
+	current, err := getGenericResource(p.kubeClient, asset.APIVersion, asset.Kind, entry.Name, p.projectConfig.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	desired, err := toUnstructuredMap(asset.ResourceData)
+	if err != nil {
+		return nil, err
+	}
+	entry.Changes = diffObject("", normalizeSecretData(desired), current.Object)
+	if len(entry.Changes) == 0 {
+		entry.Action = PlanUnchanged
+	} else {
+		entry.Action = PlanUpdate
+	}
+	return entry, nil
+}
+
+// resourceChanged reports whether the desired object sets any field to a
+// different value than the current object
+func resourceChanged(desired, current interface{}) (bool, error) {
+	desiredMap, err := toUnstructuredMap(desired)
+	if err != nil {
+		return false, err
+	}
+	currentMap, err := toUnstructuredMap(current)
+	if err != nil {
+		return false, err
+	}
+	return len(diffObject("", desiredMap, currentMap)) > 0, nil
+}
+
+// diffObject compares only the fields set in the desired object, so that
+// defaults filled in by the cluster do not show up as changes
+func diffObject(path string, desired, current interface{}) []*FieldChange {
+	_, ignored := ignoredPlanPaths[path]
+	if ignored {
+		return nil
+	}
+	switch desiredValue := desired.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		currentValue, _ := current.(map[string]interface{})
+		keys := []string{}
+		for key := range desiredValue {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		changes := []*FieldChange{}
+		for _, key := range keys {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			changes = append(changes, diffObject(fieldPath, desiredValue[key], currentValue[key])...)
+		}
+		return changes
+	case []interface{}:
+		currentValue, ok := current.([]interface{})
+		if !ok || len(currentValue) != len(desiredValue) {
+			if !ok && len(desiredValue) == 0 {
+				return nil
+			}
+			return []*FieldChange{{Path: path, Current: current, Desired: desired}}
+		}
+		changes := []*FieldChange{}
+		for i := range desiredValue {
+			changes = append(changes, diffObject(fmt.Sprintf("%s[%d]", path, i), desiredValue[i], currentValue[i])...)
+		}
+		return changes
+	default:
+		if current != nil && fmt.Sprint(desired) == fmt.Sprint(current) {
+			return nil
+		}
+		return []*FieldChange{{Path: path, Current: current, Desired: desired}}
+	}
+}
+
+// normalizeSecretData folds secret stringData into data the same way the api
+// server does, since stringData is never returned by the cluster
+func normalizeSecretData(object map[string]interface{}) map[string]interface{} {
+	stringData, ok := object["stringData"].(map[string]interface{})
+	if !ok {
+		return object
+	}
+	data, ok := object["data"].(map[string]interface{})
+	if !ok {
+		data = make(map[string]interface{})
+	}
+	for key, value := range stringData {
+		data[key] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(value)))
+	}
+	object["data"] = data
+	delete(object, "stringData")
+	return object
+}
+
+func formatPlanValue(value interface{}) string {
+	if value == nil {
+		return "<none>"
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(content)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffObject(t *testing.T) {
+	req := require.New(t)
+	desired := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":              "app",
+			"creationTimestamp": nil,
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(8080)},
+			},
+		},
+		"status": map[string]interface{}{},
+	}
+	current := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":            "app",
+			"resourceVersion": "42",
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(1),
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(80), "protocol": "TCP"},
+			},
+		},
+		"status": map[string]interface{}{
+			"replicas": int64(1),
+		},
+	}
+	changes := diffObject("", desired, current)
+	req.Len(changes, 2)
+	req.Equal("spec.ports[0].port", changes[0].Path)
+	req.Equal(int64(80), changes[0].Current)
+	req.Equal(int64(8080), changes[0].Desired)
+	req.Equal("spec.replicas", changes[1].Path)
+
+	current["spec"].(map[string]interface{})["replicas"] = int64(2)
+	current["spec"].(map[string]interface{})["ports"].([]interface{})[0].(map[string]interface{})["port"] = int64(8080)
+	req.Empty(diffObject("", desired, current))
+}
+
+func TestNormalizeSecretData(t *testing.T) {
+	req := require.New(t)
+	secret := normalizeSecretData(map[string]interface{}{
+		"stringData": map[string]interface{}{
+			"password": "secret",
+		},
+	})
+	req.Equal(map[string]interface{}{
+		"data": map[string]interface{}{
+			"password": "c2VjcmV0",
+		},
+	}, secret)
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"sync"
 )
 
 type Color string
@@ -20,27 +22,40 @@ const (
 	ColorWhite  Color = "\u001B[37m"
 )
 
+// printLock keeps lines printed by concurrent deployments from interleaving
+var printLock sync.Mutex
+
+// textOutput receives the human readable output, it is moved to stderr when
+// stdout carries json events
+var textOutput io.Writer = os.Stdout
+
 func Println(color Color, v ...interface{}) {
+	printLock.Lock()
+	defer printLock.Unlock()
 	if colorDisabled() {
-		fmt.Println(v...)
+		fmt.Fprintln(textOutput, v...)
 		return
 	}
-	fmt.Print(color)
-	fmt.Print(v...)
-	fmt.Println(colorReset)
+	fmt.Fprint(textOutput, color)
+	fmt.Fprint(textOutput, v...)
+	fmt.Fprintln(textOutput, colorReset)
 }
 
 func Printf(color Color, format string, v ...interface{}) {
+	printLock.Lock()
+	defer printLock.Unlock()
 	if colorDisabled() {
-		fmt.Printf(format, v...)
+		fmt.Fprintf(textOutput, format, v...)
 		return
 	}
-	fmt.Print(color)
-	fmt.Printf(format, v...)
-	fmt.Print(colorReset)
+	fmt.Fprint(textOutput, color)
+	fmt.Fprintf(textOutput, format, v...)
+	fmt.Fprint(textOutput, colorReset)
 }
 
 func ErrPrintln(color Color, v ...interface{}) {
+	printLock.Lock()
+	defer printLock.Unlock()
 	if colorDisabled() {
 		fmt.Fprintln(os.Stderr, v...)
 		return
@@ -51,6 +66,8 @@ func ErrPrintln(color Color, v ...interface{}) {
 }
 
 func ErrPrintf(color Color, format string, v ...interface{}) {
+	printLock.Lock()
+	defer printLock.Unlock()
 	if colorDisabled() {
 		fmt.Fprintf(os.Stderr, format, v...)
 		return
@@ -63,3 +80,31 @@ func ErrPrintf(color Color, format string, v ...interface{}) {
 func colorDisabled() bool {
 	return runtime.GOOS == "windows" || os.Getenv("IMLADRIS_NO_COLOR") == "1"
 }
+
+// prefixColors tell apart the sources of interleaved output
+var prefixColors = []Color{ColorCyan, ColorGreen, ColorYellow, ColorBlue, ColorPurple}
+
+func PrefixColor(index int) Color {
+	return prefixColors[index%len(prefixColors)]
+}
+
+// PrintPrefixed prints a line after a prefix naming where the line comes from
+func PrintPrefixed(color Color, prefix, line string) {
+	fprintPrefixed(os.Stdout, color, prefix, line)
+}
+
+// PrintTextPrefixed is PrintPrefixed for progress messages, which go to the
+// text output like the ones of Printf
+func PrintTextPrefixed(color Color, prefix, line string) {
+	fprintPrefixed(textOutput, color, prefix, line)
+}
+
+func fprintPrefixed(output io.Writer, color Color, prefix, line string) {
+	printLock.Lock()
+	defer printLock.Unlock()
+	if colorDisabled() {
+		fmt.Fprintf(output, "%s | %s\n", prefix, line)
+		return
+	}
+	fmt.Fprintf(output, "%s%s |%s %s\n", color, prefix, colorReset, line)
+}
@@ -2,31 +2,50 @@ package main
 
 import (
 	"bytes"
+	"hash/fnv"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
-	"text/template"
+	"sync"
+	"time"
 
 	"fmt"
 
 	"gopkg.in/yaml.v2"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/api/core/v1"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type Project struct {
-	kubeClient    *kubernetes.Clientset
-	projectConfig *ProjectConfig
-	projectFolder string
-	resources     []*Asset
-	services      []*Asset
-	jobs          []*Asset
-	excludes      map[string]struct{}
+	kubeClient      *KubeClient
+	projectConfig   *ProjectConfig
+	projectFolder   string
+	defaultName     bool
+	resources       []*Asset
+	services        []*Asset
+	jobs            []*Asset
+	excludes        map[string]struct{}
+	variableSources map[string]string
+	secretVariables map[string]struct{}
+	partials        []*templatePartial
+	parallel        int
+	buildParallel   int
+	buildTags       buildTagMode
+	timeout         time.Duration
+	waitReady       bool
+	dryRun          bool
+	serverDryRun    bool
+	changed         []*Asset
+	docker          *DockerClient
+	lock            sync.Mutex
 }
 
 type ProjectConfig struct {
+	Name                  string                  `yaml:"name"`
 	RootFolder            string                  `yaml:"root_folder"`
 	Pulls                 []string                `yaml:"pulls"`
 	InitUp                []string                `yaml:"init_up"`
@@ -37,23 +56,49 @@ type ProjectConfig struct {
 	Jobs                  []string                `yaml:"jobs"`
 	Resources             []string                `yaml:"resources"`
 	Excludes              []string                `yaml:"excludes"`
+	Partials              []string                `yaml:"partials"`
 	Namespace             string                  `yaml:"namespace"`
 	Variables             map[string]string       `yaml:"variables"`
+	VariableFiles         []string                `yaml:"variable_files"`
 	Build                 []*ProjectBuild         `yaml:"build"`
 	Credentials           []*DockerCredential     `yaml:"credentials"`
 	DeleteNamespace       bool                    `yaml:"delete_namespace"`
 	AutoUpdates           []*AutoUpdate           `yaml:"auto_updates"`
 	AutoUpdateCredentials []*AutoUpdateCredential `yaml:"auto_update_credentials"`
+	Environments          map[string]*Environment `yaml:"environments"`
 }
 
+// Environment overrides the project config when selected with -env, its
+// globs are added to the ones of the project
+type Environment struct {
+	Namespace string            `yaml:"namespace"`
+	Variables map[string]string `yaml:"variables"`
+	Excludes  []string          `yaml:"excludes"`
+	Resources []string          `yaml:"resources"`
+	Jobs      []string          `yaml:"jobs"`
+	Services  []string          `yaml:"services"`
+}
+
+// ProjectBuild is an image built from the folder From. Build args are
+// templates executed with the project variables. With SkipUnchanged, the
+// local or pushed image of the tag is reused when it was built from the same
+// context. The auto and git tags are only generated for the commands that
+// build or render images.
 type ProjectBuild struct {
-	Name       string `yaml:"name"`
-	VarName    string `yaml:"var_name"`
-	Tag        string `yaml:"tag"`
-	From       string `yaml:"from"`
-	Push       bool   `yaml:"push"`
-	PushLatest bool   `yaml:"push_latest"`
-	AutoClean  bool   `yaml:"auto_clean"`
+	Name          string            `yaml:"name"`
+	VarName       string            `yaml:"var_name"`
+	Tag           string            `yaml:"tag"`
+	From          string            `yaml:"from"`
+	Dockerfile    string            `yaml:"dockerfile"`
+	BuildArgs     map[string]string `yaml:"build_args"`
+	Target        string            `yaml:"target"`
+	Labels        map[string]string `yaml:"labels"`
+	CacheFrom     []string          `yaml:"cache_from"`
+	Network       string            `yaml:"network"`
+	Push          bool              `yaml:"push"`
+	PushLatest    bool              `yaml:"push_latest"`
+	AutoClean     bool              `yaml:"auto_clean"`
+	SkipUnchanged bool              `yaml:"skip_unchanged"`
 }
 
 type DockerCredential struct {
@@ -80,16 +125,30 @@ type AutoUpdateCredential struct {
 	PasswordFile string `yaml:"password_file"`
 }
 
-func readProject(kubeClient *kubernetes.Clientset, assetRoot string, config *appConfig) (*Project, error) {
+func readProject(kubeClient *KubeClient, assetRoot string, config *appConfig) (*Project, error) {
 	p := &Project{
 		kubeClient:    kubeClient,
 		projectConfig: &ProjectConfig{},
+		parallel:      config.parallel,
+		buildParallel: config.buildParallel,
+		buildTags:     config.buildTags,
+		timeout:       config.timeout,
+		dryRun:        config.dryRun,
 	}
 	var err error
 	err = p.readProjectConfig(assetRoot, config.variables)
 	if err != nil {
 		return nil, err
 	}
+	for key, value := range p.projectConfig.Variables {
+		p.setVariable(key, value, "project.yml")
+	}
+	if config.environment != "" {
+		err = p.mergeEnvironment(config.environment)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if config.namespace != "" {
 		p.projectConfig.Namespace = config.namespace
 	}
@@ -101,16 +160,33 @@ func readProject(kubeClient *kubernetes.Clientset, assetRoot string, config *app
 	} else {
 		p.projectConfig.RootFolder = p.projectFolder
 	}
-	if p.projectConfig.Variables == nil {
-		p.projectConfig.Variables = make(map[string]string)
+	if p.projectConfig.Name == "" {
+		p.projectConfig.Name, err = defaultProjectName(p.projectConfig.RootFolder)
+		if err != nil {
+			return nil, err
+		}
+		p.defaultName = true
+	}
+	p.projectConfig.Name = labelValue(p.projectConfig.Name)
+
+	// Variables are layered: project.yml and its environment, variable
+	// files, IMLADRIS_VAR_ environment variables then -variable flags
+	err = p.readVariableFiles(p.projectConfig.RootFolder, p.projectConfig.VariableFiles)
+	if err != nil {
+		return nil, err
+	}
+	err = p.readVariableFiles("", config.variableFiles)
+	if err != nil {
+		return nil, err
 	}
+	p.readEnvironmentVariables()
 	for key, value := range config.variables {
-		p.projectConfig.Variables[key] = value
+		p.setVariable(key, value, "-variable flag")
 	}
-	p.projectConfig.Variables["app_var_namespace"] = p.projectConfig.Namespace
-	p.projectConfig.Variables["app_var_home"] = os.Getenv("HOME")
-	p.projectConfig.Variables["app_var_data_dir"] = dataPath
-	p.projectConfig.Variables["app_var_cwd"] = p.projectConfig.RootFolder
+	p.setVariable("app_var_namespace", p.projectConfig.Namespace, "builtin")
+	p.setVariable("app_var_home", os.Getenv("HOME"), "builtin")
+	p.setVariable("app_var_data_dir", dataPath, "builtin")
+	p.setVariable("app_var_cwd", p.projectConfig.RootFolder, "builtin")
 
 	// Read build info
 	err = p.readBuild()
@@ -124,6 +200,12 @@ func readProject(kubeClient *kubernetes.Clientset, assetRoot string, config *app
 		return nil, err
 	}
 
+	// Read partials
+	err = p.readPartials()
+	if err != nil {
+		return nil, err
+	}
+
 	// Read assets
 	p.resources, err = p.readAssets(p.projectConfig.RootFolder, p.projectConfig.Resources, "resources/*")
 	if err != nil {
@@ -137,6 +219,16 @@ func readProject(kubeClient *kubernetes.Clientset, assetRoot string, config *app
 	if err != nil {
 		return nil, err
 	}
+
+	// Label the objects so that the ones removed from the project can be
+	// pruned
+	p.addPruneLabels()
+
+	// Roll the workloads when their configuration changes
+	err = p.addConfigChecksums()
+	if err != nil {
+		return nil, err
+	}
 	return p, nil
 }
 
@@ -162,11 +254,10 @@ func (p *Project) readProjectConfig(assetRoot string, variables variableMap) err
 	if err != nil {
 		return err
 	}
-	t, err := template.New(projectFile).Parse(string(data))
+	t, err := newTemplate(projectFile, string(data), rawRootFolder(p.projectFolder, data), nil)
 	if err != nil {
 		return err
 	}
-	t = t.Option("missingkey=error")
 	buf := &bytes.Buffer{}
 	err = t.Execute(buf, variables)
 	if err != nil {
@@ -181,16 +272,131 @@ func (p *Project) readProjectConfig(assetRoot string, variables variableMap) err
 	return nil
 }
 
+var rootFolderLine = regexp.MustCompile(`(?m)^root_folder:.*$`)
+
+// rawRootFolder reads root_folder before project.yml is rendered, so that
+// readFile resolves from the root folder in project.yml too. A templated
+// root_folder falls back to the project folder.
+func rawRootFolder(projectFolder string, data []byte) string {
+	projectConfig := &ProjectConfig{}
+	err := yaml.Unmarshal(rootFolderLine.Find(data), projectConfig)
+	if err != nil || projectConfig.RootFolder == "" || strings.Contains(projectConfig.RootFolder, "{{") {
+		return projectFolder
+	}
+	return translateFilePath(projectFolder, projectConfig.RootFolder)
+}
+
+// mergeEnvironment applies the overlay of the selected environment
+func (p *Project) mergeEnvironment(name string) error {
+	environment, ok := p.projectConfig.Environments[name]
+	if !ok {
+		available := []string{}
+		for environmentName := range p.projectConfig.Environments {
+			available = append(available, environmentName)
+		}
+		sort.Strings(available)
+		return fmt.Errorf("unknown environment %q, available environments: %s", name, strings.Join(available, ", "))
+	}
+	if environment == nil {
+		environment = &Environment{}
+	}
+	if environment.Namespace != "" {
+		p.projectConfig.Namespace = environment.Namespace
+	}
+	for key, value := range environment.Variables {
+		p.setVariable(key, value, "environment "+name)
+	}
+	p.setVariable("app_var_env", name, "builtin")
+	p.projectConfig.Excludes = append(p.projectConfig.Excludes, environment.Excludes...)
+	p.projectConfig.Resources = appendGlobs(p.projectConfig.Resources, environment.Resources, "resources/*")
+	p.projectConfig.Jobs = appendGlobs(p.projectConfig.Jobs, environment.Jobs, "jobs/*")
+	p.projectConfig.Services = appendGlobs(p.projectConfig.Services, environment.Services, "services/*")
+	return nil
+}
+
+// appendGlobs adds extra globs without losing the default glob, which only
+// applies when no glob is configured
+func appendGlobs(globs, extraGlobs []string, defaultGlob string) []string {
+	if len(extraGlobs) == 0 {
+		return globs
+	}
+	if len(globs) == 0 {
+		globs = []string{defaultGlob}
+	}
+	return append(globs, extraGlobs...)
+}
+
+func defaultProjectName(rootFolder string) (string, error) {
+	absRootFolder, err := filepath.Abs(rootFolder)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(absRootFolder), nil
+}
+
 func (p *Project) readBuild() error {
 	invalidChar := regexp.MustCompile("[^a-zA-Z0-9_]")
 	underscores := regexp.MustCompile("_+")
-	for _, build := range p.projectConfig.Build {
+	builds := p.projectConfig.Build
+	varNames := make(map[*ProjectBuild]string)
+	for _, build := range builds {
 		varName := build.VarName
 		if varName == "" {
 			varName = "build_var_" + underscores.ReplaceAllString(invalidChar.ReplaceAllString(build.Name, "_"), "_")
 		}
-		tagName := build.Name + ":" + build.Tag
-		p.projectConfig.Variables[varName] = tagName
+		varNames[build] = varName
+		if !isGeneratedTag(build.Tag) {
+			p.setVariable(varName, build.Name+":"+build.Tag, "build "+build.Name)
+		}
+	}
+	// Build args can use every variable, the images of the other builds
+	// included. A generated tag hashes the build args, so the builds whose
+	// images are used get their tag first.
+	pending := builds
+	for len(pending) > 0 {
+		waiting := []*ProjectBuild{}
+		for _, build := range pending {
+			if usesGeneratedTag(build, pending, varNames) {
+				waiting = append(waiting, build)
+				continue
+			}
+			err := p.renderBuildArgs(build)
+			if err != nil {
+				return err
+			}
+			if isGeneratedTag(build.Tag) {
+				err = p.resolveBuildTag(build)
+				if err != nil {
+					return err
+				}
+				p.setVariable(varNames[build], build.Name+":"+build.Tag, "build "+build.Name)
+			}
+		}
+		if len(waiting) == len(pending) {
+			names := []string{}
+			for _, build := range waiting {
+				names = append(names, build.Name)
+			}
+			return fmt.Errorf("build tag cycle between %s", strings.Join(names, ", "))
+		}
+		pending = waiting
+	}
+	_, err := sortBuilds(builds)
+	return err
+}
+
+func (p *Project) renderBuildArgs(build *ProjectBuild) error {
+	for key, value := range build.BuildArgs {
+		t, err := newTemplate(build.Name+" build arg "+key, value, p.projectConfig.RootFolder, nil)
+		if err != nil {
+			return err
+		}
+		buf := &bytes.Buffer{}
+		err = t.Execute(buf, p.projectConfig.Variables)
+		if err != nil {
+			return err
+		}
+		build.BuildArgs[key] = buf.String()
 	}
 	return nil
 }
@@ -210,6 +416,39 @@ func (p *Project) readExcludes() error {
 	return nil
 }
 
+// readPartials loads the files of shared templates that assets can include
+func (p *Project) readPartials() error {
+	globs := p.projectConfig.Partials
+	if len(globs) == 0 {
+		globs = []string{"partials/*"}
+	}
+	for _, glob := range globs {
+		glob = translateFilePath(p.projectConfig.RootFolder, glob)
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return err
+		}
+		for _, filename := range matches {
+			stat, err := os.Stat(filename)
+			if err != nil {
+				return err
+			}
+			if stat.IsDir() {
+				continue
+			}
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+			p.partials = append(p.partials, &templatePartial{
+				filename: filename,
+				data:     string(data),
+			})
+		}
+	}
+	return nil
+}
+
 func (p *Project) readAssets(rootFolder string, globs []string, defaultGlob string) ([]*Asset, error) {
 	if len(globs) == 0 {
 		globs = []string{defaultGlob}
@@ -229,18 +468,16 @@ func (p *Project) readAssets(rootFolder string, globs []string, defaultGlob stri
 		if ok {
 			continue
 		}
-		asset, err := p.readAsset(filename)
+		fileAssets, err := p.readAsset(filename)
 		if err != nil {
 			return nil, err
 		}
-		if asset != nil {
-			assets = append(assets, asset)
-		}
+		assets = append(assets, fileAssets...)
 	}
 	return assets, nil
 }
 
-func (p *Project) readAsset(filename string) (*Asset, error) {
+func (p *Project) readAsset(filename string) ([]*Asset, error) {
 	stat, err := os.Stat(filename)
 	if err != nil {
 		return nil, err
@@ -248,34 +485,48 @@ func (p *Project) readAsset(filename string) (*Asset, error) {
 	if stat.IsDir() {
 		return nil, nil
 	}
-	data, err := ioutil.ReadFile(filename)
+	// Encrypted assets, e.g. secrets, are decrypted before being templated
+	data, err := readSecretFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	t, err := template.New(filename).Funcs(getFuncMap()).Parse(string(data))
+	t, err := newTemplate(filename, string(data), p.projectConfig.RootFolder, p.partials)
 	if err != nil {
 		return nil, err
 	}
-	t = t.Option("missingkey=error")
 	buf := &bytes.Buffer{}
 	err = t.Execute(buf, p.projectConfig.Variables)
 	if err != nil {
 		return nil, err
 	}
-	asset, err := parseAsset(filename, buf.Bytes())
+	assets, err := parseAssets(filename, buf.Bytes())
 	if err != nil {
 		return nil, err
 	}
-	asset.UpdateNamespace(p.projectConfig.Namespace)
-	return asset, nil
+	for _, asset := range assets {
+		asset.UpdateNamespace(p.projectConfig.Namespace)
+	}
+	return assets, nil
+}
+
+func (p *Project) allAssets() []*Asset {
+	assets := []*Asset{}
+	assets = append(assets, p.resources...)
+	assets = append(assets, p.jobs...)
+	assets = append(assets, p.services...)
+	return assets
 }
 
 func (p *Project) runScripts(scripts []string) error {
 	for _, script := range scripts {
+		if p.dryRun {
+			Printf(ColorPurple, "Dry run, would run script %q\n", script)
+			continue
+		}
 		Printf(ColorYellow, "Running script %q\n", script)
 		cmd := exec.Command("sh", "-c", script)
 		cmd.Dir = p.projectConfig.RootFolder
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = textOutput
 		cmd.Stderr = os.Stderr
 		err := cmd.Run()
 		if err != nil {
@@ -285,9 +536,34 @@ func (p *Project) runScripts(scripts []string) error {
 	return nil
 }
 
+// dockerClient connects to the docker engine the first time a command needs
+// it, so that projects without builds work where docker is not installed
+func (p *Project) dockerClient() (*DockerClient, error) {
+	if p.docker != nil {
+		return p.docker, nil
+	}
+	client, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	err = client.Ping()
+	if err != nil {
+		return nil, err
+	}
+	p.docker = client
+	return client, nil
+}
+
 func (p *Project) dockerLogin() error {
+	if p.dryRun || len(p.projectConfig.Credentials) == 0 {
+		return nil
+	}
+	client, err := p.dockerClient()
+	if err != nil {
+		return err
+	}
 	for _, credential := range p.projectConfig.Credentials {
-		err := dockerLogin(p.projectConfig.RootFolder, credential)
+		err = client.Login(p.projectConfig.RootFolder, credential)
 		if err != nil {
 			return err
 		}
@@ -296,13 +572,57 @@ func (p *Project) dockerLogin() error {
 }
 
 func (p *Project) Up() error {
-	if len(p.projectConfig.Pulls) > 0 {
-		err := p.pullImages()
+	return p.deploy(p.reported("create", p.createAsset))
+}
+
+func (p *Project) Apply() error {
+	return p.deploy(p.reported("apply", p.applyAsset))
+}
+
+// reported wraps an action on assets so that its result and duration are
+// reported with -output json. Assets the action ignores return no result.
+func (p *Project) reported(action string, assetAction func(asset *Asset) (string, error)) func(asset *Asset) error {
+	return func(asset *Asset) error {
+		start := time.Now()
+		result, err := assetAction(asset)
+		reportEvent(asset.Kind, asset.ResourceData.(Meta).GetName(), p.projectConfig.Namespace, action, result, start, err)
+		return err
+	}
+}
+
+// printAsset prints a progress line of an asset. With -parallel, the lines
+// are prefixed with the kind and name of the asset, so that the output of
+// concurrent deployments can be told apart.
+func (p *Project) printAsset(kind, name string, color Color, format string, v ...interface{}) {
+	if p.parallel <= 1 {
+		Printf(color, format, v...)
+		return
+	}
+	prefix := kind + "/" + name
+	hash := fnv.New32a()
+	hash.Write([]byte(prefix))
+	message := strings.TrimSuffix(fmt.Sprintf(format, v...), "\n")
+	for _, line := range strings.Split(message, "\n") {
+		PrintTextPrefixed(PrefixColor(int(hash.Sum32()%1024)), prefix, line)
+	}
+}
+
+// deploy runs the up lifecycle: pulls, init scripts, builds, then deployAsset
+// on resources, jobs and services in order, then finalize scripts. Inside
+// each group assets are deployed in dependency order, concurrently up to the
+// -parallel flag. With -wait, the workloads are then waited for until ready.
+func (p *Project) deploy(deployAsset func(asset *Asset) error) error {
+	err := p.checkDryRun()
+	if err != nil {
+		return err
+	}
+	if len(p.projectConfig.Pulls) > 0 && !p.dryRun {
+		err = p.pullImages()
 		if err != nil {
 			return err
 		}
 	}
-	err := p.runScripts(p.projectConfig.InitUp)
+	err = p.runScripts(p.projectConfig.InitUp)
 	if err != nil {
 		return err
 	}
@@ -314,24 +634,28 @@ func (p *Project) Up() error {
 	if err != nil {
 		return err
 	}
-	err = createNamespace(p.kubeClient, p.projectConfig.Namespace)
-	if err != nil {
-		return err
-	}
-	for _, resource := range p.resources {
-		err := p.createAsset(resource)
+	if !p.dryRun {
+		err = createNamespace(p.kubeClient, p.projectConfig.Namespace)
 		if err != nil {
 			return err
 		}
 	}
-	for _, job := range p.jobs {
-		err := p.createAsset(job)
+	deployed := make(map[string]struct{})
+	for _, assets := range [][]*Asset{p.resources, p.jobs, p.services} {
+		graph, err := buildDependencyGraph(assets, deployed)
 		if err != nil {
 			return err
 		}
+		err = graph.run(p.parallel, deployAsset)
+		if err != nil {
+			return err
+		}
+		for _, asset := range assets {
+			deployed[assetKey(asset.Kind, asset.ResourceData.(Meta).GetName())] = struct{}{}
+		}
 	}
-	for _, service := range p.services {
-		err := p.createAsset(service)
+	if p.waitReady && !p.dryRun {
+		err = p.waitForAssets(p.changed)
 		if err != nil {
 			return err
 		}
@@ -375,7 +699,11 @@ func (p *Project) pullImage(asset *Asset, imagesToPull map[string]struct{}) erro
 		imageName := pieces[0]
 		_, ok := imagesToPull[imageName]
 		if ok {
-			err = dockerPull(image)
+			client, err := p.dockerClient()
+			if err != nil {
+				return err
+			}
+			err = client.Pull(image)
 			if err != nil {
 				return err
 			}
@@ -384,52 +712,40 @@ func (p *Project) pullImage(asset *Asset, imagesToPull map[string]struct{}) erro
 	return nil
 }
 
-func (p *Project) build() error {
-	for _, build := range p.projectConfig.Build {
-		err := p.buildDockerImage(build)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (p *Project) buildDockerImage(build *ProjectBuild) error {
-	buildContext := translateFilePath(p.projectConfig.RootFolder, build.From)
-	tagName := build.Name + ":" + build.Tag
-	err := dockerBuildImage(buildContext, tagName)
+func (p *Project) Down() error {
+	err := p.checkDryRun()
 	if err != nil {
 		return err
 	}
-	if !build.Push {
-		return nil
-	}
-	return dockerPush(tagName, build.PushLatest)
-}
-
-func (p *Project) Down() error {
-	err := p.runScripts(p.projectConfig.InitDown)
+	err = p.runScripts(p.projectConfig.InitDown)
 	if err != nil {
 		return err
 	}
+	destroyAsset := p.reported("destroy", p.destroyAsset)
 	for _, service := range p.services {
-		err := p.destroyAsset(service)
+		err := destroyAsset(service)
 		if err != nil {
 			return err
 		}
 	}
 	for _, job := range p.jobs {
-		err := p.destroyAsset(job)
+		err := destroyAsset(job)
 		if err != nil {
 			return err
 		}
 	}
 	for _, resource := range p.resources {
-		err := p.destroyAsset(resource)
+		err := destroyAsset(resource)
 		if err != nil {
 			return err
 		}
 	}
+	if p.dryRun {
+		if p.projectConfig.DeleteNamespace {
+			Printf(ColorPurple, "Dry run, would delete namespace %q\n", p.projectConfig.Namespace)
+		}
+		return p.runScripts(p.projectConfig.FinalizeDown)
+	}
 	if p.projectConfig.DeleteNamespace {
 		err = deleteNamespace(p.kubeClient, p.projectConfig.Namespace)
 		if err != nil {
@@ -438,13 +754,23 @@ func (p *Project) Down() error {
 	}
 	for _, build := range p.projectConfig.Build {
 		if build.AutoClean {
-			err = dockerRmi(build.Name + ":" + build.Tag)
+			client, err := p.dockerClient()
 			if err != nil {
 				// Bail error here
 				ErrPrintln(ColorRed, err)
+				break
+			}
+			if isGeneratedTag(build.Tag) {
+				Printf(ColorYellow, "Cannot resolve the %s tag of %q, not removing its image\n", build.Tag, build.Name)
+			} else {
+				err = client.RemoveImage(build.Name + ":" + build.Tag)
+				if err != nil {
+					// Bail error here
+					ErrPrintln(ColorRed, err)
+				}
 			}
 			if build.Push && build.PushLatest {
-				err = dockerRmi(build.Name + ":latest")
+				err = client.RemoveImage(build.Name + ":latest")
 				if err != nil {
 					// Also Bail error here
 					ErrPrintln(ColorRed, err)
@@ -456,12 +782,17 @@ func (p *Project) Down() error {
 }
 
 func (p *Project) DownServices() error {
-	err := p.runScripts(p.projectConfig.InitDown)
+	err := p.checkDryRun()
 	if err != nil {
 		return err
 	}
+	err = p.runScripts(p.projectConfig.InitDown)
+	if err != nil {
+		return err
+	}
+	destroyAsset := p.reported("destroy", p.destroyAsset)
 	for _, service := range p.services {
-		err := p.destroyAsset(service)
+		err := destroyAsset(service)
 		if err != nil {
 			return err
 		}
@@ -470,12 +801,17 @@ func (p *Project) DownServices() error {
 }
 
 func (p *Project) DownJobs() error {
-	err := p.runScripts(p.projectConfig.InitDown)
+	err := p.checkDryRun()
+	if err != nil {
+		return err
+	}
+	err = p.runScripts(p.projectConfig.InitDown)
 	if err != nil {
 		return err
 	}
+	destroyAsset := p.reported("destroy", p.destroyAsset)
 	for _, job := range p.jobs {
-		err := p.destroyAsset(job)
+		err := destroyAsset(job)
 		if err != nil {
 			return err
 		}
@@ -485,124 +821,247 @@ func (p *Project) DownJobs() error {
 
 func (p *Project) Debug() {
 	Println(ColorGreen, "=========> Resources  <=========")
-	for _, asset := range p.resources {
-		asset.Debug()
-	}
+	p.debugAssets(p.resources)
 	Println(ColorGreen, "=========>  Services  <=========")
-	for _, asset := range p.services {
-		asset.Debug()
-	}
+	p.debugAssets(p.services)
 	Println(ColorGreen, "=========>    Jobs    <=========")
-	for _, asset := range p.jobs {
+	p.debugAssets(p.jobs)
+}
+
+func (p *Project) debugAssets(assets []*Asset) {
+	for _, asset := range assets {
 		asset.Debug()
+		start := time.Now()
+		name := asset.ResourceData.(Meta).GetName()
+		object, err := toUnstructuredMap(asset.ResourceData)
+		if err != nil {
+			reportEvent(asset.Kind, name, p.projectConfig.Namespace, "debug", "", start, err)
+			continue
+		}
+		pruneGeneratedFields(object)
+		jsonReporter.report(&Event{
+			Kind:      asset.Kind,
+			Name:      name,
+			Namespace: p.projectConfig.Namespace,
+			Action:    "debug",
+			Result:    ResultRendered,
+			Duration:  time.Since(start).Seconds(),
+			Object:    object,
+		})
 	}
 }
 
-func (p *Project) createAsset(asset *Asset) error {
+func (p *Project) createAsset(asset *Asset) (string, error) {
 	objectMeta := asset.ResourceData.(Meta)
 	assetName := objectMeta.GetName()
-	Printf(ColorYellow, "Creating %s %q from namespace %q\n", asset.Kind, assetName, p.projectConfig.Namespace)
-	existed, err := checkResourceExist(p.kubeClient, asset.Kind, assetName, p.projectConfig.Namespace)
+	p.printAsset(asset.Kind, assetName, ColorYellow, "Creating %s %q from namespace %q\n", asset.Kind, assetName, p.projectConfig.Namespace)
+	existed, err := checkResourceExist(p.kubeClient, asset.APIVersion, asset.Kind, assetName, p.projectConfig.Namespace)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if existed {
-		Println(ColorGreen, "====> Existed")
-		return nil
+		p.printAsset(asset.Kind, assetName, ColorGreen, "====> Existed\n")
+		return ResultExisted, nil
 	}
-	err = createResource(p.kubeClient, asset.Kind, assetName, p.projectConfig.Namespace, asset.ResourceData)
-	if err == nil {
-		Println(ColorGreen, "====> Success")
+	err = p.createResource(asset, assetName)
+	if err != nil {
+		return "", err
 	}
-	return err
+	p.printAsset(asset.Kind, assetName, ColorGreen, "====> Success\n")
+	return p.changeResult(asset, ResultCreated), nil
 }
 
-func (p *Project) destroyAsset(asset *Asset) error {
+func (p *Project) destroyAsset(asset *Asset) (string, error) {
 	objectMeta := asset.ResourceData.(Meta)
 	assetName := objectMeta.GetName()
-	Printf(ColorYellow, "Destroying %s %q from namespace %q\n", asset.Kind, assetName, p.projectConfig.Namespace)
-	existed, err := checkResourceExist(p.kubeClient, asset.Kind, assetName, p.projectConfig.Namespace)
+	p.printAsset(asset.Kind, assetName, ColorYellow, "Destroying %s %q from namespace %q\n", asset.Kind, assetName, p.projectConfig.Namespace)
+	existed, err := checkResourceExist(p.kubeClient, asset.APIVersion, asset.Kind, assetName, p.projectConfig.Namespace)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if !existed && asset.Kind != "pod" {
-		Println(ColorGreen, "====> Not existed")
-		return nil
+		p.printAsset(asset.Kind, assetName, ColorGreen, "====> Not existed\n")
+		return ResultNotExisted, nil
 	}
-	err = destroyResource(p.kubeClient, asset.Kind, assetName, p.projectConfig.Namespace)
-	if err == nil {
-		Println(ColorGreen, "====> Success")
+	err = p.destroyResource(asset.APIVersion, asset.Kind, assetName)
+	if err != nil {
+		return "", err
 	}
-	return err
+	p.printAsset(asset.Kind, assetName, ColorGreen, "====> Success\n")
+	return p.changeResult(nil, ResultDeleted), nil
 }
 
 func (p *Project) Update() error {
-	if len(p.projectConfig.Pulls) > 0 {
-		err := p.pullImages()
-		if err != nil {
-			return err
-		}
-	}
-	err := p.runScripts(p.projectConfig.InitUp)
+	return p.deploy(p.reported("update", p.updateAsset))
+}
+
+func (p *Project) updateAsset(asset *Asset) (string, error) {
+	objectMeta := asset.ResourceData.(Meta)
+	assetName := objectMeta.GetName()
+	p.printAsset(asset.Kind, assetName, ColorYellow, "Updating %s %q from namespace %q\n", asset.Kind, assetName, p.projectConfig.Namespace)
+	existed, err := checkResourceExist(p.kubeClient, asset.APIVersion, asset.Kind, assetName, p.projectConfig.Namespace)
 	if err != nil {
-		return err
+		return "", err
 	}
-	err = p.dockerLogin()
-	if err != nil {
-		return err
+	if !existed {
+		p.printAsset(asset.Kind, assetName, ColorGreen, "====> Not existed\n")
+		return ResultNotExisted, nil
 	}
-	err = p.build()
+	err = p.updateResource(asset, assetName)
 	if err != nil {
-		return err
+		return "", err
 	}
-	err = createNamespace(p.kubeClient, p.projectConfig.Namespace)
+	p.printAsset(asset.Kind, assetName, ColorGreen, "====> Success\n")
+	return p.changeResult(asset, ResultUpdated), nil
+}
+
+func (p *Project) applyAsset(asset *Asset) (string, error) {
+	objectMeta := asset.ResourceData.(Meta)
+	assetName := objectMeta.GetName()
+	p.printAsset(asset.Kind, assetName, ColorYellow, "Applying %s %q from namespace %q\n", asset.Kind, assetName, p.projectConfig.Namespace)
+	existed, err := checkResourceExist(p.kubeClient, asset.APIVersion, asset.Kind, assetName, p.projectConfig.Namespace)
 	if err != nil {
-		return err
+		return "", err
 	}
-	for _, resource := range p.resources {
-		err := p.updateAsset(resource)
+	if existed && isRecreatedKind(asset.APIVersion, asset.Kind) {
+		// Jobs and pods cannot be patched, they are recreated instead
+		err = p.updateResource(asset, assetName)
 		if err != nil {
-			return err
+			return "", err
 		}
+		p.printAsset(asset.Kind, assetName, ColorGreen, "====> Success\n")
+		return p.changeResult(asset, ResultUpdated), nil
 	}
-	for _, job := range p.jobs {
-		err := p.updateAsset(job)
+	if existed {
+		patched, err := p.applyResource(asset, assetName)
 		if err != nil {
-			return err
+			return "", err
 		}
-	}
-	for _, service := range p.services {
-		err := p.updateAsset(service)
-		if err != nil {
-			return err
+		if !patched {
+			p.printAsset(asset.Kind, assetName, ColorGreen, "====> Unchanged\n")
+			return ResultUnchanged, nil
 		}
+		p.printAsset(asset.Kind, assetName, ColorGreen, "====> Patched\n")
+		return p.changeResult(asset, ResultPatched), nil
 	}
-	return p.runScripts(p.projectConfig.FinalizeUp)
+	configuration, err := lastAppliedConfiguration(asset.ResourceData)
+	if err != nil {
+		return "", err
+	}
+	asset.AddAnnotations(map[string]string{
+		v1.LastAppliedConfigAnnotation: configuration,
+	})
+	err = p.createResource(asset, assetName)
+	if err != nil {
+		return "", err
+	}
+	p.printAsset(asset.Kind, assetName, ColorGreen, "====> Created\n")
+	return p.changeResult(asset, ResultCreated), nil
 }
 
-func (p *Project) updateAsset(asset *Asset) error {
-	if asset.Kind != "pod" && asset.Kind != "deployment" && asset.Kind != "configmap" && asset.Kind != "secret" {
+// checkDryRun decides, with -dry-run, whether the api server can validate
+// the changes or they are only printed
+func (p *Project) checkDryRun() error {
+	if !p.dryRun {
 		return nil
 	}
-	objectMeta := asset.ResourceData.(Meta)
-	assetName := objectMeta.GetName()
-	Printf(ColorYellow, "Updating %s %q from namespace %q\n", asset.Kind, assetName, p.projectConfig.Namespace)
-	existed, err := checkResourceExist(p.kubeClient, asset.Kind, assetName, p.projectConfig.Namespace)
+	supported, err := supportsDryRun(p.kubeClient)
 	if err != nil {
 		return err
 	}
-	if !existed {
-		Println(ColorGreen, "====> Not existed")
+	if !supported {
+		Println(ColorPurple, "Dry run, the cluster does not support server side dry run, changes are not validated")
 		return nil
 	}
-	err = updateResource(p.kubeClient, asset.Kind, assetName, p.projectConfig.Namespace, asset.ResourceData)
-	if err == nil {
-		Println(ColorGreen, "====> Success")
+	_, err = p.kubeClient.Core().Namespaces().Get(p.projectConfig.Namespace, apiv1.GetOptions{})
+	if isResourceNotExist(err) {
+		Printf(ColorPurple, "Dry run, would create namespace %q, changes are not validated\n", p.projectConfig.Namespace)
+		return nil
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	p.serverDryRun = true
+	return nil
+}
+
+// createResource creates the object of an asset, with -dry-run it is only
+// validated by the server
+func (p *Project) createResource(asset *Asset, name string) error {
+	if !p.dryRun {
+		return createResource(p.kubeClient, asset.APIVersion, asset.Kind, name, p.projectConfig.Namespace, asset.ResourceData)
+	}
+	p.printAsset(asset.Kind, name, ColorPurple, "====> Dry run, would create %s %q\n", asset.Kind, name)
+	if !p.serverDryRun {
+		return nil
+	}
+	return dryRunCreateResource(p.kubeClient, asset.APIVersion, asset.Kind, p.projectConfig.Namespace, asset.ResourceData)
+}
+
+func (p *Project) updateResource(asset *Asset, name string) error {
+	if !p.dryRun {
+		return updateResource(p.kubeClient, asset.APIVersion, asset.Kind, name, p.projectConfig.Namespace, asset.ResourceData)
+	}
+	p.printAsset(asset.Kind, name, ColorPurple, "====> Dry run, would update %s %q\n", asset.Kind, name)
+	if !p.serverDryRun {
+		return nil
+	}
+	return dryRunUpdateResource(p.kubeClient, asset.APIVersion, asset.Kind, name, p.projectConfig.Namespace, asset.ResourceData)
+}
+
+func (p *Project) destroyResource(apiVersion, kind, name string) error {
+	if !p.dryRun {
+		return destroyResource(p.kubeClient, apiVersion, kind, name, p.projectConfig.Namespace)
+	}
+	p.printAsset(kind, name, ColorPurple, "====> Dry run, would destroy %s %q\n", kind, name)
+	if !p.serverDryRun {
+		return nil
+	}
+	return dryRunDestroyResource(p.kubeClient, apiVersion, kind, name, p.projectConfig.Namespace)
+}
+
+// applyResource patches the object of an asset, without a server side dry
+// run the plan tells whether it would be patched
+func (p *Project) applyResource(asset *Asset, name string) (bool, error) {
+	if !p.dryRun {
+		return applyResource(p.kubeClient, asset.APIVersion, asset.Kind, name, p.projectConfig.Namespace, asset.ResourceData, nil)
+	}
+	if p.serverDryRun {
+		return applyResource(p.kubeClient, asset.APIVersion, asset.Kind, name, p.projectConfig.Namespace, asset.ResourceData, dryRunAll)
+	}
+	entry, err := p.planAsset(asset)
+	if err != nil {
+		return false, err
+	}
+	return entry.Action == PlanUpdate, nil
+}
+
+// changeResult returns the result of a change to the object of an asset and
+// marks the asset changed. With -dry-run nothing changed, the would-be result
+// is returned and -wait has nothing to wait for.
+func (p *Project) changeResult(asset *Asset, result string) string {
+	if p.dryRun {
+		return dryRunResults[result]
+	}
+	if asset != nil {
+		p.markChanged(asset)
+	}
+	return result
+}
+
+// markChanged records the assets created or modified by the current command,
+// the ones -wait waits for
+func (p *Project) markChanged(asset *Asset) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.changed = append(p.changed, asset)
 }
 
 func (p *Project) AutoUpdate(version string) error {
+	err := p.checkDryRun()
+	if err != nil {
+		return err
+	}
 	if version == "" || version == "auto" {
 		Println(ColorYellow, "Will automatically search for latest version")
 	} else {
@@ -616,20 +1075,23 @@ func (p *Project) AutoUpdate(version string) error {
 	for _, credential := range p.projectConfig.AutoUpdateCredentials {
 		credentials[credential.Name] = credential
 	}
+	autoupdateAsset := p.reported("autoupdate", func(asset *Asset) (string, error) {
+		return p.autoupdateAsset(asset, autoUpdates, credentials, version)
+	})
 	for _, resource := range p.resources {
-		err := p.autoupdateAsset(resource, autoUpdates, credentials, version)
+		err := autoupdateAsset(resource)
 		if err != nil {
 			return err
 		}
 	}
 	for _, job := range p.jobs {
-		err := p.autoupdateAsset(job, autoUpdates, credentials, version)
+		err := autoupdateAsset(job)
 		if err != nil {
 			return err
 		}
 	}
 	for _, service := range p.services {
-		err := p.autoupdateAsset(service, autoUpdates, credentials, version)
+		err := autoupdateAsset(service)
 		if err != nil {
 			return err
 		}
@@ -637,28 +1099,28 @@ func (p *Project) AutoUpdate(version string) error {
 	return nil
 }
 
-func (p *Project) autoupdateAsset(asset *Asset, autoUpdates map[string]*AutoUpdate, autoUpdateCredentials map[string]*AutoUpdateCredential, newTag string) error {
+func (p *Project) autoupdateAsset(asset *Asset, autoUpdates map[string]*AutoUpdate, autoUpdateCredentials map[string]*AutoUpdateCredential, newTag string) (string, error) {
 	if asset.Kind != "deployment" {
-		return nil
+		return "", nil
 	}
 	objectMeta := asset.ResourceData.(Meta)
 	assetName := objectMeta.GetName()
 	autoUpdateInfo, ok := autoUpdates[assetName]
 	if !ok {
-		return nil
+		return "", nil
 	}
 	Printf(ColorYellow, "Autoupdate %s %q from namespace %q\n", asset.Kind, assetName, p.projectConfig.Namespace)
-	existed, err := checkResourceExist(p.kubeClient, asset.Kind, assetName, p.projectConfig.Namespace)
+	existed, err := checkResourceExist(p.kubeClient, asset.APIVersion, asset.Kind, assetName, p.projectConfig.Namespace)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if !existed {
 		Println(ColorGreen, "====> Not existed")
-		return nil
+		return ResultNotExisted, nil
 	}
-	deploymentInfo, err := getDeployment(p.kubeClient, assetName, p.projectConfig.Namespace)
+	deploymentInfo, err := getDeployment(p.kubeClient, asset.APIVersion, assetName, p.projectConfig.Namespace)
 	if err != nil {
-		return err
+		return "", err
 	}
 	newContainers := make(map[string]string)
 	for _, containerInfo := range autoUpdateInfo.Containers {
@@ -670,7 +1132,7 @@ func (p *Project) autoupdateAsset(asset *Asset, autoUpdates map[string]*AutoUpda
 		// We only support gcr.io at the moment
 		if !strings.HasPrefix(oldContainer.Image, "gcr.io") && (newTag == "" || newTag == "auto") {
 			ErrPrintf(ColorPurple, "====> We only support gcr.io at the moment, skipping container %q (%q)\n", containerInfo.Name, oldContainer.Image)
-			return nil
+			return ResultSkipped, nil
 		}
 		if newTag == "" || newTag == "auto" {
 			credential := autoUpdateCredentials[containerInfo.Credential]
@@ -678,12 +1140,12 @@ func (p *Project) autoupdateAsset(asset *Asset, autoUpdates map[string]*AutoUpda
 			if credential != nil {
 				username, password, err = readAutoupdateCredential(p.projectConfig.RootFolder, credential)
 				if err != nil {
-					return err
+					return "", err
 				}
 			}
 			newTag, err = findNewImageTag(oldContainer.Image, username, password)
 			if err != nil {
-				return err
+				return "", err
 			}
 		}
 		if newTag == oldContainer.Tag {
@@ -694,21 +1156,29 @@ func (p *Project) autoupdateAsset(asset *Asset, autoUpdates map[string]*AutoUpda
 	}
 	if len(newContainers) == 0 {
 		Println(ColorGreen, "====> No new container found")
-		return nil
+		return ResultUnchanged, nil
 	}
-	for i, container := range deploymentInfo.Deployment.Spec.Template.Spec.Containers {
+	for i, container := range deploymentInfo.Template.Spec.Containers {
 		newImage, ok := newContainers[container.Name]
 		if ok {
 			container.Image = newImage
-			deploymentInfo.Deployment.Spec.Template.Spec.Containers[i] = container
+			deploymentInfo.Template.Spec.Containers[i] = container
 		}
 	}
-	_, err = p.kubeClient.Extensions().Deployments(p.projectConfig.Namespace).Update(deploymentInfo.Deployment)
-	if err == nil {
-		Printf(ColorGreen, "====> Updated deployment %q:\n", assetName)
-		for containerName, newImage := range newContainers {
-			Printf(ColorGreen, "====> %q to %q\n", containerName, newImage)
+	if p.dryRun {
+		Printf(ColorPurple, "====> Dry run, would update deployment %q\n", assetName)
+		if p.serverDryRun {
+			err = dryRunUpdateResource(p.kubeClient, asset.APIVersion, asset.Kind, assetName, p.projectConfig.Namespace, deploymentInfo.Deployment)
 		}
+	} else {
+		err = updateDeployment(p.kubeClient, p.projectConfig.Namespace, deploymentInfo)
 	}
-	return err
+	if err != nil {
+		return "", err
+	}
+	Printf(ColorGreen, "====> Updated deployment %q:\n", assetName)
+	for containerName, newImage := range newContainers {
+		Printf(ColorGreen, "====> %q to %q\n", containerName, newImage)
+	}
+	return p.changeResult(nil, ResultUpdated), nil
 }
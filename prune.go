@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	projectLabel = "imladris.io/project"
+	assetLabel   = "imladris.io/asset"
+)
+
+func (p *Project) addPruneLabels() {
+	for _, asset := range p.allAssets() {
+		assetFile, err := filepath.Rel(p.projectConfig.RootFolder, asset.filename)
+		if err != nil {
+			assetFile = filepath.Base(asset.filename)
+		}
+		asset.AddLabels(map[string]string{
+			projectLabel: p.projectConfig.Name,
+			assetLabel:   labelValue(assetFile),
+		})
+	}
+}
+
+// checkPruneName refuses a defaulted name, two project folders with the same
+// name in a namespace would prune each other's objects
+func (p *Project) checkPruneName() error {
+	if p.defaultName {
+		return fmt.Errorf("project %q has no name in project.yml, set one to prune its orphans", p.projectConfig.Name)
+	}
+	return nil
+}
+
+func (p *Project) findOrphans() ([]unstructured.Unstructured, error) {
+	selector := projectLabel + "=" + p.projectConfig.Name + "," + assetLabel
+	objects, err := listLabelledObjects(p.kubeClient, p.projectConfig.Namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	return orphanObjects(p.allAssets(), objects), nil
+}
+
+// orphanObjects skips endpoints, they copy the labels of their service and go
+// away with it
+func orphanObjects(assets []*Asset, objects []unstructured.Unstructured) []unstructured.Unstructured {
+	managed := make(map[string]struct{})
+	for _, asset := range assets {
+		objectMeta := asset.ResourceData.(Meta)
+		managed[asset.Kind+"/"+objectMeta.GetName()] = struct{}{}
+	}
+	services := make(map[string]struct{})
+	for _, object := range objects {
+		if strings.ToLower(object.GetKind()) == "service" {
+			services[object.GetName()] = struct{}{}
+		}
+	}
+	seen := make(map[types.UID]struct{})
+	orphans := []unstructured.Unstructured{}
+	for _, object := range objects {
+		kind := strings.ToLower(object.GetKind())
+		_, isManaged := managed[kind+"/"+object.GetName()]
+		if isManaged {
+			continue
+		}
+		if kind == "endpoints" {
+			_, isManagedService := managed["service/"+object.GetName()]
+			_, isService := services[object.GetName()]
+			if isManagedService || isService {
+				continue
+			}
+		}
+		// A kind served by several groups is listed once per group
+		_, isSeen := seen[object.GetUID()]
+		if isSeen && object.GetUID() != "" {
+			continue
+		}
+		seen[object.GetUID()] = struct{}{}
+		orphans = append(orphans, object)
+	}
+	return orphans
+}
+
+func (p *Project) Prune() error {
+	err := p.checkDryRun()
+	if err != nil {
+		return err
+	}
+	err = p.checkPruneName()
+	if err != nil {
+		return err
+	}
+	orphans, err := p.findOrphans()
+	if err != nil {
+		return err
+	}
+	for _, orphan := range orphans {
+		kind := strings.ToLower(orphan.GetKind())
+		Printf(ColorYellow, "Pruning %s %q from namespace %q\n", kind, orphan.GetName(), p.projectConfig.Namespace)
+		start := time.Now()
+		err = p.destroyResource(orphan.GetAPIVersion(), kind, orphan.GetName())
+		reportEvent(kind, orphan.GetName(), p.projectConfig.Namespace, "prune", p.changeResult(nil, ResultDeleted), start, err)
+		if err != nil {
+			return err
+		}
+		Println(ColorGreen, "====> Success")
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apiv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestOrphanObjects(t *testing.T) {
+	req := require.New(t)
+	object := func(apiVersion, kind, name, uid string) unstructured.Unstructured {
+		object := unstructured.Unstructured{}
+		object.SetAPIVersion(apiVersion)
+		object.SetKind(kind)
+		object.SetName(name)
+		object.SetUID(types.UID(uid))
+		return object
+	}
+	assets := []*Asset{{
+		APIVersion:   "v1",
+		Kind:         "service",
+		ResourceData: &corev1.Service{ObjectMeta: apiv1.ObjectMeta{Name: "web"}},
+	}}
+	objects := []unstructured.Unstructured{
+		object("v1", "Service", "web", "1"),
+		object("v1", "Endpoints", "web", "2"),
+		object("v1", "Service", "legacy", "3"),
+		object("v1", "Endpoints", "legacy", "4"),
+		object("apps/v1", "Deployment", "legacy", "5"),
+		object("extensions/v1beta1", "Deployment", "legacy", "5"),
+		object("v1", "ConfigMap", "web", "6"),
+	}
+	orphans := orphanObjects(assets, objects)
+	names := []string{}
+	for _, orphan := range orphans {
+		names = append(names, orphan.GetKind()+"/"+orphan.GetName())
+	}
+	req.Equal([]string{"Service/legacy", "Deployment/legacy", "ConfigMap/web"}, names)
+}
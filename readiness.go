@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type Readiness struct {
+	Ready   bool
+	Failed  bool
+	Message string
+}
+
+// workloadKinds are the kinds up -wait waits for
+var workloadKinds = map[string]struct{}{
+	"deployment":  {},
+	"statefulset": {},
+	"daemonset":   {},
+	"job":         {},
+	"pod":         {},
+}
+
+func isWorkload(kind string) bool {
+	_, ok := workloadKinds[kind]
+	return ok
+}
+
+// workloadReadiness treats kinds without a rollout as always ready
+func workloadReadiness(object *unstructured.Unstructured) *Readiness {
+	switch strings.ToLower(object.GetKind()) {
+	case "deployment":
+		return deploymentReadiness(object)
+	case "statefulset":
+		return statefulSetReadiness(object)
+	case "daemonset":
+		return daemonSetReadiness(object)
+	case "job":
+		return jobReadiness(object)
+	case "pod":
+		return podReadiness(object)
+	case "persistentvolumeclaim":
+		return persistentVolumeClaimReadiness(object)
+	case "service":
+		return serviceReadiness(object)
+	default:
+		return &Readiness{Ready: true}
+	}
+}
+
+func observedLatestGeneration(object *unstructured.Unstructured) bool {
+	observedGeneration, _, _ := unstructured.NestedInt64(object.Object, "status", "observedGeneration")
+	return observedGeneration >= object.GetGeneration()
+}
+
+func desiredReplicas(object *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(object.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return replicas
+}
+
+func deploymentReadiness(object *unstructured.Unstructured) *Readiness {
+	for _, condition := range nestedMaps(object.Object, "status", "conditions") {
+		if condition["type"] == "Progressing" && condition["reason"] == "ProgressDeadlineExceeded" {
+			return &Readiness{Failed: true, Message: fmt.Sprint(condition["message"])}
+		}
+	}
+	replicas := desiredReplicas(object)
+	totalReplicas, _, _ := unstructured.NestedInt64(object.Object, "status", "replicas")
+	updatedReplicas, _, _ := unstructured.NestedInt64(object.Object, "status", "updatedReplicas")
+	availableReplicas, _, _ := unstructured.NestedInt64(object.Object, "status", "availableReplicas")
+	return &Readiness{
+		Ready:   observedLatestGeneration(object) && updatedReplicas == replicas && totalReplicas == replicas && availableReplicas == replicas,
+		Message: fmt.Sprintf("%d/%d replicas updated, %d available", updatedReplicas, replicas, availableReplicas),
+	}
+}
+
+func statefulSetReadiness(object *unstructured.Unstructured) *Readiness {
+	replicas := desiredReplicas(object)
+	readyReplicas, _, _ := unstructured.NestedInt64(object.Object, "status", "readyReplicas")
+	updatedReplicas, found, _ := unstructured.NestedInt64(object.Object, "status", "updatedReplicas")
+	if !found {
+		// Older clusters do not report updated replicas
+		updatedReplicas = readyReplicas
+	}
+	return &Readiness{
+		Ready:   observedLatestGeneration(object) && readyReplicas == replicas && updatedReplicas == replicas,
+		Message: fmt.Sprintf("%d/%d replicas ready, %d updated", readyReplicas, replicas, updatedReplicas),
+	}
+}
+
+func daemonSetReadiness(object *unstructured.Unstructured) *Readiness {
+	desired, _, _ := unstructured.NestedInt64(object.Object, "status", "desiredNumberScheduled")
+	updated, _, _ := unstructured.NestedInt64(object.Object, "status", "updatedNumberScheduled")
+	available, _, _ := unstructured.NestedInt64(object.Object, "status", "numberAvailable")
+	return &Readiness{
+		Ready:   observedLatestGeneration(object) && updated == desired && available == desired,
+		Message: fmt.Sprintf("%d/%d pods updated, %d available", updated, desired, available),
+	}
+}
+
+func jobReadiness(object *unstructured.Unstructured) *Readiness {
+	for _, condition := range nestedMaps(object.Object, "status", "conditions") {
+		if condition["status"] != "True" {
+			continue
+		}
+		switch condition["type"] {
+		case "Complete":
+			return &Readiness{Ready: true, Message: "completed"}
+		case "Failed":
+			return &Readiness{Failed: true, Message: fmt.Sprint(condition["message"])}
+		}
+	}
+	active, _, _ := unstructured.NestedInt64(object.Object, "status", "active")
+	failed, _, _ := unstructured.NestedInt64(object.Object, "status", "failed")
+	return &Readiness{
+		Message: fmt.Sprintf("%d active, %d failed", active, failed),
+	}
+}
+
+func podReadiness(object *unstructured.Unstructured) *Readiness {
+	phase, _, _ := unstructured.NestedString(object.Object, "status", "phase")
+	switch phase {
+	case "Succeeded":
+		return &Readiness{Ready: true, Message: phase}
+	case "Failed":
+		reason, _, _ := unstructured.NestedString(object.Object, "status", "reason")
+		return &Readiness{Failed: true, Message: strings.TrimSpace(phase + " " + reason)}
+	}
+	for _, condition := range nestedMaps(object.Object, "status", "conditions") {
+		if condition["type"] == "Ready" && condition["status"] == "True" {
+			return &Readiness{Ready: true, Message: phase}
+		}
+	}
+	message := phase
+	for _, containerStatus := range nestedMaps(object.Object, "status", "containerStatuses") {
+		reason, _, _ := unstructured.NestedString(containerStatus, "state", "waiting", "reason")
+		if reason != "" {
+			message += fmt.Sprintf(", %s %s", containerStatus["name"], reason)
+		}
+	}
+	return &Readiness{Message: message}
+}
+
+func persistentVolumeClaimReadiness(object *unstructured.Unstructured) *Readiness {
+	phase, _, _ := unstructured.NestedString(object.Object, "status", "phase")
+	return &Readiness{
+		Ready:   phase == "Bound",
+		Failed:  phase == "Lost",
+		Message: phase,
+	}
+}
+
+func serviceReadiness(object *unstructured.Unstructured) *Readiness {
+	serviceType, _, _ := unstructured.NestedString(object.Object, "spec", "type")
+	if serviceType != "LoadBalancer" {
+		return &Readiness{Ready: true, Message: "no load balancer needed"}
+	}
+	ingresses := nestedMaps(object.Object, "status", "loadBalancer", "ingress")
+	if len(ingresses) == 0 {
+		return &Readiness{Message: "waiting for load balancer ingress"}
+	}
+	addresses := []string{}
+	for _, ingress := range ingresses {
+		for _, field := range []string{"ip", "hostname"} {
+			address, ok := ingress[field].(string)
+			if ok && address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return &Readiness{Ready: true, Message: strings.Join(addresses, ", ")}
+}
+
+type WaitTarget struct {
+	APIVersion string
+	Kind       string
+	Name       string
+}
+
+type WaitCondition struct {
+	ConditionType string
+	Deleted       bool
+}
+
+func parseWaitTarget(value string) (*WaitTarget, error) {
+	pieces := strings.SplitN(value, "/", 2)
+	if len(pieces) != 2 || pieces[0] == "" || pieces[1] == "" {
+		return nil, fmt.Errorf("invalid target %q, expected kind/name", value)
+	}
+	return &WaitTarget{
+		Kind: strings.ToLower(pieces[0]),
+		Name: pieces[1],
+	}, nil
+}
+
+func parseWaitCondition(value string) (*WaitCondition, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if value == "delete" {
+		return &WaitCondition{Deleted: true}, nil
+	}
+	pieces := strings.SplitN(value, "=", 2)
+	if len(pieces) != 2 || pieces[0] != "condition" || pieces[1] == "" {
+		return nil, fmt.Errorf("invalid wait condition %q, expected condition=<type> or delete", value)
+	}
+	return &WaitCondition{ConditionType: pieces[1]}, nil
+}
+
+func (target *WaitTarget) readiness(kubeClient *KubeClient, namespace string, condition *WaitCondition) (*Readiness, error) {
+	object, err := getGenericResource(kubeClient, target.APIVersion, target.Kind, target.Name, namespace)
+	if isResourceNotExist(err) {
+		return target.missingReadiness(namespace, condition)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case condition == nil:
+		return workloadReadiness(object), nil
+	case condition.Deleted:
+		return &Readiness{Message: "not deleted yet"}, nil
+	default:
+		return conditionReadiness(object, condition.ConditionType), nil
+	}
+}
+
+// missingReadiness fails right away, a missing object never becomes ready,
+// unless the wait is for a deletion
+func (target *WaitTarget) missingReadiness(namespace string, condition *WaitCondition) (*Readiness, error) {
+	if condition != nil && condition.Deleted {
+		return &Readiness{Ready: true, Message: "deleted"}, nil
+	}
+	return nil, fmt.Errorf("%s %q not found in namespace %q", target.Kind, target.Name, namespace)
+}
+
+func conditionReadiness(object *unstructured.Unstructured, conditionType string) *Readiness {
+	status := "not reported"
+	for _, condition := range nestedMaps(object.Object, "status", "conditions") {
+		if strings.EqualFold(fmt.Sprint(condition["type"]), conditionType) {
+			status = fmt.Sprint(condition["status"])
+			break
+		}
+	}
+	// A failed workload only fails the wait when the condition is not met,
+	// so that waiting for condition=Failed succeeds
+	readiness := workloadReadiness(object)
+	if status != "True" && readiness.Failed {
+		return readiness
+	}
+	return &Readiness{
+		Ready:   status == "True",
+		Message: fmt.Sprintf("condition %s is %s", conditionType, status),
+	}
+}
+
+func waitForTargets(kubeClient *KubeClient, namespace string, targets []*WaitTarget, condition *WaitCondition, timeout time.Duration) error {
+	pending := targets
+	start := time.Now()
+	deadline := start.Add(timeout)
+	messages := make(map[*WaitTarget]string)
+	for len(pending) > 0 {
+		stillPending := []*WaitTarget{}
+		for _, target := range pending {
+			readiness, err := target.readiness(kubeClient, namespace, condition)
+			if err != nil {
+				reportEvent(target.Kind, target.Name, namespace, "wait", "", start, err)
+				return err
+			}
+			if readiness.Failed {
+				printEvents(kubeClient, namespace, target.Name)
+				err = fmt.Errorf("%s %q failed: %s", target.Kind, target.Name, readiness.Message)
+				reportEvent(target.Kind, target.Name, namespace, "wait", "", start, err)
+				return err
+			}
+			if readiness.Ready {
+				Printf(ColorGreen, "====> %s %q is ready: %s\n", target.Kind, target.Name, readiness.Message)
+				reportEvent(target.Kind, target.Name, namespace, "wait", ResultReady, start, nil)
+				continue
+			}
+			if messages[target] != readiness.Message {
+				Printf(ColorYellow, "Waiting for %s %q: %s\n", target.Kind, target.Name, readiness.Message)
+				messages[target] = readiness.Message
+			}
+			stillPending = append(stillPending, target)
+		}
+		pending = stillPending
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			err := fmt.Errorf("timeout while waiting for %d resources", len(pending))
+			for _, target := range pending {
+				printEvents(kubeClient, namespace, target.Name)
+				reportEvent(target.Kind, target.Name, namespace, "wait", "", start, err)
+			}
+			return err
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return nil
+}
+
+func (p *Project) waitForAssets(assets []*Asset) error {
+	targets := []*WaitTarget{}
+	for _, asset := range assets {
+		if isWorkload(asset.Kind) {
+			targets = append(targets, &WaitTarget{
+				APIVersion: asset.APIVersion,
+				Kind:       asset.Kind,
+				Name:       asset.ResourceData.(Meta).GetName(),
+			})
+		}
+	}
+	return waitForTargets(p.kubeClient, p.projectConfig.Namespace, targets, nil, p.timeout)
+}
+
+func printEvents(kubeClient *KubeClient, namespace, name string) {
+	events, err := getEvents(kubeClient, namespace, name)
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		return
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+	if len(events) > 5 {
+		events = events[len(events)-5:]
+	}
+	for _, event := range events {
+		ErrPrintf(ColorRed, "====> %s %s %s: %s\n", name, event.Type, event.Reason, event.Message)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDeploymentReadiness(t *testing.T) {
+	req := require.New(t)
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":       "app",
+			"generation": int64(2),
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+		},
+		"status": map[string]interface{}{
+			"observedGeneration": int64(2),
+			"replicas":           int64(3),
+			"updatedReplicas":    int64(2),
+			"availableReplicas":  int64(2),
+		},
+	}}
+	readiness := workloadReadiness(deployment)
+	req.False(readiness.Ready)
+	req.False(readiness.Failed)
+	req.Equal("2/2 replicas updated, 2 available", readiness.Message)
+
+	deployment.Object["status"].(map[string]interface{})["replicas"] = int64(2)
+	req.True(workloadReadiness(deployment).Ready)
+}
+
+func TestJobReadinessConditions(t *testing.T) {
+	req := require.New(t)
+	job := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name": "init",
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Suspended", "status": "False"},
+				map[string]interface{}{"type": "Failed", "status": "True", "message": "BackoffLimitExceeded"},
+			},
+		},
+	}}
+	readiness := workloadReadiness(job)
+	req.False(readiness.Ready)
+	req.True(readiness.Failed)
+	req.Equal("BackoffLimitExceeded", readiness.Message)
+
+	readiness = conditionReadiness(job, "Failed")
+	req.True(readiness.Ready)
+	req.False(readiness.Failed)
+	req.Equal("condition Failed is True", readiness.Message)
+	readiness = conditionReadiness(job, "Complete")
+	req.False(readiness.Ready)
+	req.True(readiness.Failed)
+}
+
+func TestServiceReadiness(t *testing.T) {
+	req := require.New(t)
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name": "front",
+		},
+		"spec": map[string]interface{}{
+			"type": "LoadBalancer",
+		},
+	}}
+	req.False(workloadReadiness(service).Ready)
+
+	service.Object["status"] = map[string]interface{}{
+		"loadBalancer": map[string]interface{}{
+			"ingress": []interface{}{
+				map[string]interface{}{"ip": "10.0.0.1"},
+			},
+		},
+	}
+	readiness := workloadReadiness(service)
+	req.True(readiness.Ready)
+	req.Equal("10.0.0.1", readiness.Message)
+}
+
+func TestConditionReadiness(t *testing.T) {
+	req := require.New(t)
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name": "app",
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Progressing", "status": "True"},
+				map[string]interface{}{"type": "Available", "status": "False"},
+			},
+		},
+	}}
+	readiness := conditionReadiness(deployment, "available")
+	req.False(readiness.Ready)
+	req.Equal("condition available is False", readiness.Message)
+	req.True(conditionReadiness(deployment, "Progressing").Ready)
+}
+
+func TestParseWait(t *testing.T) {
+	req := require.New(t)
+	target, err := parseWaitTarget("StatefulSet/db")
+	req.NoError(err)
+	req.Equal(&WaitTarget{Kind: "statefulset", Name: "db"}, target)
+	_, err = parseWaitTarget("db")
+	req.Error(err)
+
+	condition, err := parseWaitCondition("")
+	req.NoError(err)
+	req.Nil(condition)
+	condition, err = parseWaitCondition("delete")
+	req.NoError(err)
+	req.True(condition.Deleted)
+	condition, err = parseWaitCondition("condition=Ready")
+	req.NoError(err)
+	req.Equal("Ready", condition.ConditionType)
+	_, err = parseWaitCondition("ready")
+	req.Error(err)
+}
+
+func TestMissingTargetReadiness(t *testing.T) {
+	req := require.New(t)
+	target := &WaitTarget{Kind: "deployment", Name: "app"}
+	_, err := target.missingReadiness("default", nil)
+	req.Error(err)
+	req.Equal(`deployment "app" not found in namespace "default"`, err.Error())
+	_, err = target.missingReadiness("default", &WaitCondition{ConditionType: "Available"})
+	req.Error(err)
+
+	readiness, err := target.missingReadiness("default", &WaitCondition{Deleted: true})
+	req.NoError(err)
+	req.True(readiness.Ready)
+}
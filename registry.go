@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+	manifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	ociMediaType      = "application/vnd.oci.image.manifest.v1+json"
+)
+
+type RegistryError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *RegistryError) Error() string {
+	return fmt.Sprintf("registry error %d: %s", e.StatusCode, e.Message)
+}
+
+func isRegistryNotFound(err error) bool {
+	registryErr, ok := err.(*RegistryError)
+	return ok && registryErr.StatusCode == http.StatusNotFound
+}
+
+func registryRepository(name string) (string, string) {
+	repository, _ := splitImage(name)
+	registry := imageRegistry(name)
+	pieces := strings.SplitN(repository, "/", 2)
+	if len(pieces) == 2 && (strings.ContainsAny(pieces[0], ".:") || pieces[0] == "localhost") {
+		repository = pieces[1]
+	}
+	if registry == defaultRegistry {
+		if !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+		return "https://" + dockerHubRegistry, repository
+	}
+	host := strings.Split(registry, ":")[0]
+	if host == "localhost" || host == "127.0.0.1" {
+		return "http://" + registry, repository
+	}
+	return "https://" + registry, repository
+}
+
+// RemoteImageLabels reads the image config without pulling its layers
+func (c *DockerClient) RemoteImageLabels(name string) (map[string]string, error) {
+	baseURL, repository := registryRepository(name)
+	_, tag := splitImage(name)
+	manifest := struct {
+		MediaType string `json:"mediaType"`
+		Config    struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}{}
+	err := c.registryGet(name, baseURL+"/v2/"+repository+"/manifests/"+tag, manifestMediaType+", "+ociMediaType, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Config.Digest == "" {
+		// Manifest lists are not built by imladris, they carry no label
+		return nil, nil
+	}
+	config := struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}{}
+	err = c.registryGet(name, baseURL+"/v2/"+repository+"/blobs/"+manifest.Config.Digest, "", &config)
+	if err != nil {
+		return nil, err
+	}
+	return config.Config.Labels, nil
+}
+
+func (c *DockerClient) registryGet(name, requestURL, accept string, value interface{}) error {
+	response, err := c.registryRequest(requestURL, accept, "")
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		response.Body.Close()
+		authorization, err := c.registryAuthorization(name, challenge)
+		if err != nil {
+			return err
+		}
+		response, err = c.registryRequest(requestURL, accept, authorization)
+		if err != nil {
+			return err
+		}
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 400 {
+		content, _ := ioutil.ReadAll(response.Body)
+		return &RegistryError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(content))}
+	}
+	return json.NewDecoder(response.Body).Decode(value)
+}
+
+func (c *DockerClient) registryRequest(requestURL, accept, authorization string) (*http.Response, error) {
+	request, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	return http.DefaultClient.Do(request)
+}
+
+func (c *DockerClient) registryAuthorization(name, challenge string) (string, error) {
+	auth, ok := c.auths[imageRegistry(name)]
+	if !ok {
+		auth = &registryAuth{}
+	}
+	scheme := strings.SplitN(challenge, " ", 2)[0]
+	if strings.EqualFold(scheme, "basic") {
+		request := &http.Request{Header: make(http.Header)}
+		request.SetBasicAuth(auth.Username, auth.Password)
+		return request.Header.Get("Authorization"), nil
+	}
+	if !strings.EqualFold(scheme, "bearer") {
+		return "", fmt.Errorf("unsupported registry authentication %q for %q", challenge, name)
+	}
+	parameters := parseChallenge(strings.TrimPrefix(challenge, scheme))
+	realm := parameters["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry authentication %q for %q has no realm", challenge, name)
+	}
+	query := url.Values{}
+	for _, key := range []string{"service", "scope"} {
+		if parameters[key] != "" {
+			query.Set(key, parameters[key])
+		}
+	}
+	request, err := http.NewRequest("GET", realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if auth.Username != "" {
+		request.SetBasicAuth(auth.Username, auth.Password)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 400 {
+		content, _ := ioutil.ReadAll(response.Body)
+		return "", &RegistryError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(content))}
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// challengeParameter matches the key="value" parameters of a
+// WWW-Authenticate header, values such as scopes may hold commas
+var challengeParameter = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+func parseChallenge(parameters string) map[string]string {
+	values := make(map[string]string)
+	for _, match := range challengeParameter.FindAllStringSubmatch(parameters, -1) {
+		values[match[1]] = match[2]
+	}
+	return values
+}
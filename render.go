@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// renderAsset serializes an asset as it would be sent to the cluster, without
+// the empty fields typed objects carry
+func renderAsset(asset *Asset) ([]byte, error) {
+	object, err := toUnstructuredMap(asset.ResourceData)
+	if err != nil {
+		return nil, err
+	}
+	pruneGeneratedFields(object)
+	return yaml.Marshal(object)
+}
+
+// Render writes every asset, in deployment order, as one multi document yaml
+func (p *Project) Render(w io.Writer) error {
+	for i, asset := range p.allAssets() {
+		data, err := renderAsset(asset)
+		if err != nil {
+			return fmt.Errorf("unable to render asset %s: %s", asset.Source(), err.Error())
+		}
+		if i > 0 {
+			_, err = io.WriteString(w, "---\n")
+			if err != nil {
+				return err
+			}
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderToFolder writes every asset to its own file, the files are numbered
+// so that sorting them by name gives the deployment order
+func (p *Project) RenderToFolder(folder string) error {
+	err := os.MkdirAll(folder, 0755)
+	if err != nil {
+		return err
+	}
+	for i, asset := range p.allAssets() {
+		data, err := renderAsset(asset)
+		if err != nil {
+			return fmt.Errorf("unable to render asset %s: %s", asset.Source(), err.Error())
+		}
+		name := asset.ResourceData.(Meta).GetName()
+		filename := filepath.Join(folder, fmt.Sprintf("%03d-%s-%s.yml", i+1, asset.Kind, name))
+		err = ioutil.WriteFile(filename, data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	req := require.New(t)
+	config := &appConfig{}
+	project, err := readProject(nil, "test-assets/config-tests/multi-document", config)
+	req.NoError(err)
+
+	output := &bytes.Buffer{}
+	req.NoError(project.Render(output))
+	documents := strings.Split(output.String(), "---\n")
+	req.Len(documents, 3)
+	req.Contains(documents[0], "kind: Deployment")
+	req.Contains(documents[0], "namespace: default")
+	req.Contains(documents[0], "imladris.io/project: multi-document")
+	req.NotContains(documents[0], "status:")
+	req.NotContains(documents[0], "creationTimestamp")
+	req.NotContains(documents[0], "{}")
+	req.Contains(documents[2], "key: value")
+
+	folder, err := ioutil.TempDir("", "imladris-render")
+	req.NoError(err)
+	defer os.RemoveAll(folder)
+	req.NoError(project.RenderToFolder(folder))
+	files, err := filepath.Glob(filepath.Join(folder, "*.yml"))
+	req.NoError(err)
+	req.Equal([]string{
+		filepath.Join(folder, "001-deployment-app.yml"),
+		filepath.Join(folder, "002-service-app.yml"),
+		filepath.Join(folder, "003-configmap-app.yml"),
+	}, files)
+}
+
+func TestPruneGeneratedFields(t *testing.T) {
+	req := require.New(t)
+	object := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "app", "creationTimestamp": nil},
+		"spec": map[string]interface{}{
+			"strategy": map[string]interface{}{},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"creationTimestamp": nil},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "resources": map[string]interface{}{}},
+					},
+					"volumes": []interface{}{
+						map[string]interface{}{"name": "cache", "emptyDir": map[string]interface{}{}},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{},
+	}
+	pruneGeneratedFields(object)
+	req.Equal(map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "app"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app"},
+					},
+					"volumes": []interface{}{
+						map[string]interface{}{"name": "cache", "emptyDir": map[string]interface{}{}},
+					},
+				},
+			},
+		},
+	}, object)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Results of an action on a cluster object
+const (
+	ResultCreated    = "created"
+	ResultUpdated    = "updated"
+	ResultPatched    = "patched"
+	ResultDeleted    = "deleted"
+	ResultReady      = "ready"
+	ResultRendered   = "rendered"
+	ResultExisted    = "existed"
+	ResultNotExisted = "not-existed"
+	ResultUnchanged  = "unchanged"
+	ResultSkipped    = "skipped"
+	ResultFailed     = "failed"
+	ResultBuilt      = "built"
+	ResultPushed     = "pushed"
+	// With -dry-run nothing is changed, the results tell what would be
+	ResultWouldCreate = "would-create"
+	ResultWouldUpdate = "would-update"
+	ResultWouldPatch  = "would-patch"
+	ResultWouldDelete = "would-delete"
+)
+
+// dryRunResults are the results reported with -dry-run in place of changes
+var dryRunResults = map[string]string{
+	ResultCreated: ResultWouldCreate,
+	ResultUpdated: ResultWouldUpdate,
+	ResultPatched: ResultWouldPatch,
+	ResultDeleted: ResultWouldDelete,
+}
+
+// Event is printed on stdout for every action with -output json
+type Event struct {
+	Type      string                 `json:"type"`
+	Kind      string                 `json:"kind"`
+	Name      string                 `json:"name"`
+	Namespace string                 `json:"namespace"`
+	Action    string                 `json:"action"`
+	Result    string                 `json:"result"`
+	Duration  float64                `json:"duration"`
+	Error     string                 `json:"error,omitempty"`
+	Object    map[string]interface{} `json:"object,omitempty"`
+}
+
+// Summary is printed on stdout once a command is done with -output json,
+// objects are listed as "kind/name". With -dry-run the objects that would be
+// created, changed or deleted are only listed in WouldChange.
+type Summary struct {
+	Type        string   `json:"type"`
+	Success     bool     `json:"success"`
+	Error       string   `json:"error,omitempty"`
+	Created     []string `json:"created"`
+	Changed     []string `json:"changed"`
+	WouldChange []string `json:"would_change"`
+	Skipped     []string `json:"skipped"`
+	Failed      []string `json:"failed"`
+}
+
+type reporter struct {
+	enabled bool
+	output  io.Writer
+	lock    sync.Mutex
+	summary Summary
+}
+
+var jsonReporter = newReporter(os.Stdout)
+
+func newReporter(output io.Writer) *reporter {
+	return &reporter{
+		output: output,
+		summary: Summary{
+			Type:        "summary",
+			Created:     []string{},
+			Changed:     []string{},
+			WouldChange: []string{},
+			Skipped:     []string{},
+			Failed:      []string{},
+		},
+	}
+}
+
+// enableJSONOutput prints events on stdout and moves the text output to
+// stderr so that stdout can be parsed
+func enableJSONOutput() {
+	jsonReporter.enabled = true
+	textOutput = os.Stderr
+}
+
+// reportEvent records the outcome of an action started at start, an empty
+// result without error means nothing was done and is not reported
+func reportEvent(kind, name, namespace, action, result string, start time.Time, err error) {
+	if result == "" && err == nil {
+		return
+	}
+	event := &Event{
+		Kind:      kind,
+		Name:      name,
+		Namespace: namespace,
+		Action:    action,
+		Result:    result,
+		Duration:  time.Since(start).Seconds(),
+	}
+	if err != nil {
+		event.Result = ResultFailed
+		event.Error = err.Error()
+	}
+	jsonReporter.report(event)
+}
+
+func (r *reporter) report(event *Event) {
+	event.Type = "event"
+	r.lock.Lock()
+	object := event.Kind + "/" + event.Name
+	switch event.Result {
+	case ResultCreated:
+		r.summary.Created = append(r.summary.Created, object)
+	case ResultUpdated, ResultPatched, ResultDeleted, ResultBuilt, ResultPushed:
+		r.summary.Changed = append(r.summary.Changed, object)
+	case ResultWouldCreate, ResultWouldUpdate, ResultWouldPatch, ResultWouldDelete:
+		r.summary.WouldChange = append(r.summary.WouldChange, object)
+	case ResultExisted, ResultNotExisted, ResultUnchanged, ResultSkipped:
+		r.summary.Skipped = append(r.summary.Skipped, object)
+	case ResultFailed:
+		r.summary.Failed = append(r.summary.Failed, object)
+	}
+	r.lock.Unlock()
+	if r.enabled {
+		r.print(event)
+	}
+}
+
+// finishReport prints the summary of the command, err is its outcome
+func finishReport(err error) {
+	jsonReporter.finish(err)
+}
+
+func (r *reporter) finish(err error) {
+	if !r.enabled {
+		return
+	}
+	r.lock.Lock()
+	summary := r.summary
+	r.lock.Unlock()
+	summary.Success = err == nil
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	r.print(&summary)
+}
+
+func (r *reporter) print(value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		ErrPrintln(ColorRed, err)
+		return
+	}
+	printLock.Lock()
+	defer printLock.Unlock()
+	r.output.Write(append(data, '\n'))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReporterSummary(t *testing.T) {
+	req := require.New(t)
+	output := &bytes.Buffer{}
+	r := newReporter(output)
+	r.report(&Event{Kind: "deployment", Name: "app", Action: "create", Result: ResultCreated})
+	r.finish(nil)
+	req.Equal("", output.String())
+
+	r.enabled = true
+	r.report(&Event{Kind: "service", Name: "app", Action: "create", Result: ResultExisted})
+	r.report(&Event{Kind: "job", Name: "init", Action: "create", Result: ResultFailed, Error: "boom"})
+	r.finish(errors.New("boom"))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	req.Len(lines, 3)
+	event := &Event{}
+	req.NoError(json.Unmarshal([]byte(lines[1]), event))
+	req.Equal("event", event.Type)
+	req.Equal("boom", event.Error)
+	summary := &Summary{}
+	req.NoError(json.Unmarshal([]byte(lines[2]), summary))
+	req.Equal("summary", summary.Type)
+	req.False(summary.Success)
+	req.Equal([]string{"deployment/app"}, summary.Created)
+	req.Equal([]string{"service/app"}, summary.Skipped)
+	req.Equal([]string{"job/init"}, summary.Failed)
+}
+
+func TestReporterDryRunSummary(t *testing.T) {
+	req := require.New(t)
+	output := &bytes.Buffer{}
+	r := newReporter(output)
+	r.enabled = true
+	p := &Project{dryRun: true}
+	asset := &Asset{Kind: "deployment"}
+	r.report(&Event{Kind: "deployment", Name: "app", Action: "create", Result: p.changeResult(asset, ResultCreated)})
+	r.report(&Event{Kind: "service", Name: "app", Action: "destroy", Result: p.changeResult(nil, ResultDeleted)})
+	r.finish(nil)
+	req.Empty(p.changed)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	req.Len(lines, 3)
+	event := &Event{}
+	req.NoError(json.Unmarshal([]byte(lines[0]), event))
+	req.Equal(ResultWouldCreate, event.Result)
+	summary := &Summary{}
+	req.NoError(json.Unmarshal([]byte(lines[2]), summary))
+	req.Empty(summary.Created)
+	req.Empty(summary.Changed)
+	req.Equal([]string{"deployment/app", "service/app"}, summary.WouldChange)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// encryptedHeader starts the files encrypted by imladris secret encrypt,
+	// the rest of the file is the base64 nonce and AES-256-GCM ciphertext
+	encryptedHeader = "IMLADRIS-AES256-GCM\n"
+	// secretKeyEnv holds the base64 encryption key
+	secretKeyEnv = "IMLADRIS_SECRET_KEY"
+	// secretKeyFileEnv points to a file holding the base64 encryption key
+	secretKeyFileEnv = "IMLADRIS_SECRET_KEY_FILE"
+)
+
+// loadSecretKey reads the key from IMLADRIS_SECRET_KEY, the file named by
+// IMLADRIS_SECRET_KEY_FILE, or ~/.imladris/secret.key in that order
+func loadSecretKey() ([]byte, error) {
+	encodedKey := os.Getenv(secretKeyEnv)
+	source := secretKeyEnv
+	if encodedKey == "" {
+		keyFile := os.Getenv(secretKeyFileEnv)
+		if keyFile == "" {
+			keyFile = filepath.Join(os.Getenv("HOME"), ".imladris", "secret.key")
+		}
+		data, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("no secret key, set %s or %s, or create %q with imladris secret keygen", secretKeyEnv, secretKeyFileEnv, keyFile)
+			}
+			return nil, err
+		}
+		encodedKey = string(data)
+		source = keyFile
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key from %s: %s", source, err.Error())
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid secret key from %s: expected 32 bytes, got %d", source, len(key))
+	}
+	return key, nil
+}
+
+func generateSecretKey() (string, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedHeader))
+}
+
+func encryptData(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return []byte(encryptedHeader + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+func decryptData(key, data []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return nil, errors.New("data is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data[len(encryptedHeader):])))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted data is truncated")
+	}
+	nonce := sealed[:gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("unable to decrypt data, wrong secret key or corrupted data")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readSecretFile reads a file, decrypting it when it was encrypted with
+// imladris secret encrypt. Only encrypted files need the secret key.
+func readSecretFile(filename string) ([]byte, error) {
+	data, _, err := readSecretFileState(filename)
+	return data, err
+}
+
+// readSecretFileState reads a file like readSecretFile and tells whether it
+// was encrypted
+func readSecretFileState(filename string) ([]byte, bool, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, false, err
+	}
+	if !isEncrypted(data) {
+		return data, false, nil
+	}
+	key, err := loadSecretKey()
+	if err != nil {
+		return nil, true, err
+	}
+	plaintext, err := decryptData(key, data)
+	if err != nil {
+		return nil, true, fmt.Errorf("%q: %s", filename, err.Error())
+	}
+	return plaintext, true, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	req := require.New(t)
+	key := make([]byte, 32)
+	encrypted, err := encryptData(key, []byte("mellon"))
+	req.NoError(err)
+	req.True(isEncrypted(encrypted))
+	req.NotContains(string(encrypted), "mellon")
+
+	plaintext, err := decryptData(key, encrypted)
+	req.NoError(err)
+	req.Equal("mellon", string(plaintext))
+
+	otherKey := make([]byte, 32)
+	otherKey[0] = 1
+	_, err = decryptData(otherKey, encrypted)
+	req.Error(err)
+}
+
+func TestEncryptedProjectFiles(t *testing.T) {
+	req := require.New(t)
+	key, err := generateSecretKey()
+	req.NoError(err)
+	os.Setenv(secretKeyEnv, key)
+	defer os.Unsetenv(secretKeyEnv)
+	decodedKey, err := base64.StdEncoding.DecodeString(key)
+	req.NoError(err)
+
+	folder, err := ioutil.TempDir("", "imladris-secret")
+	req.NoError(err)
+	defer os.RemoveAll(folder)
+	writeFile := func(name, content string, encrypt bool) {
+		data := []byte(content)
+		if encrypt {
+			data, err = encryptData(decodedKey, data)
+			req.NoError(err)
+		}
+		req.NoError(os.MkdirAll(filepath.Dir(filepath.Join(folder, name)), 0755))
+		req.NoError(ioutil.WriteFile(filepath.Join(folder, name), data, 0600))
+	}
+	writeFile("project.yml", "variable_files:\n  - secrets.yml\n", false)
+	writeFile("secrets.yml", "db_password: mellon\n", true)
+	writeFile("services/secret.yml", `apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+stringData:
+  password: {{ .db_password }}
+  user: elrond
+`, true)
+
+	project, err := readProject(nil, folder, &appConfig{})
+	req.NoError(err)
+	req.Equal("mellon", project.projectConfig.Variables["db_password"])
+	output := &bytes.Buffer{}
+	textOutput = output
+	project.PrintVariables()
+	textOutput = os.Stdout
+	req.Contains(output.String(), "db_password = \""+maskedValue+"\"")
+	req.NotContains(output.String(), "mellon")
+	secret, ok := project.services[0].ResourceData.(*v1.Secret)
+	req.True(ok)
+	req.Equal("mellon", secret.StringData["password"])
+	req.Equal("elrond", secret.StringData["user"])
+
+	os.Setenv(secretKeyEnv, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	_, err = readProject(nil, folder, &appConfig{})
+	req.Error(err)
+}
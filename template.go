@@ -1,12 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"text/template"
+
+	"gopkg.in/yaml.v2"
 )
 
+// templatePartial is a file of shared templates, made available to include
+type templatePartial struct {
+	filename string
+	data     string
+}
+
 func makePath(segments ...string) (string, error) {
 	if len(segments) > 0 && strings.HasPrefix(segments[0], "/") {
 		return filepath.Join(segments...), nil
@@ -19,8 +36,131 @@ func makePath(segments ...string) (string, error) {
 	return filepath.Join(paths...), nil
 }
 
-func getFuncMap() template.FuncMap {
+// getFuncMap returns the functions available to project.yml and assets,
+// readFile resolves relative paths from the root folder of the project
+func getFuncMap(rootFolder string) template.FuncMap {
 	return template.FuncMap{
-		"makePath": makePath,
+		"makePath":  makePath,
+		"default":   defaultValue,
+		"required":  required,
+		"quote":     quote,
+		"indent":    indent,
+		"nindent":   nindent,
+		"toYaml":    toYaml,
+		"toJson":    toJSON,
+		"b64enc":    b64enc,
+		"b64dec":    b64dec,
+		"sha256sum": sha256sum,
+		"env":       os.Getenv,
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"replace":   replace,
+		"readFile": func(filename string) (string, error) {
+			data, err := ioutil.ReadFile(translateFilePath(rootFolder, filename))
+			return string(data), err
+		},
+	}
+}
+
+// newTemplate parses data with the function library. include executes a
+// named template defined by the template itself or by one of the partials.
+func newTemplate(name, data, rootFolder string, partials []*templatePartial) (*template.Template, error) {
+	var t *template.Template
+	funcMap := getFuncMap(rootFolder)
+	funcMap["include"] = func(name string, data interface{}) (string, error) {
+		buf := &bytes.Buffer{}
+		err := t.ExecuteTemplate(buf, name, data)
+		return buf.String(), err
+	}
+	t = template.New(name).Funcs(funcMap).Option("missingkey=error")
+	for _, partial := range partials {
+		_, err := t.New(partial.filename).Parse(partial.data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.Parse(data)
+}
+
+func isEmptyValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	default:
+		return false
+	}
+}
+
+// defaultValue returns the given value, or fallback when it is missing or
+// empty, e.g. {{ index . "replicas" | default "1" }}
+func defaultValue(fallback interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || isEmptyValue(given[0]) {
+		return fallback
+	}
+	return given[0]
+}
+
+func required(message string, value interface{}) (interface{}, error) {
+	if isEmptyValue(value) {
+		return nil, errors.New(message)
+	}
+	return value, nil
+}
+
+func quote(value interface{}) string {
+	return fmt.Sprintf("%q", fmt.Sprint(value))
+}
+
+func indent(spaces int, value string) string {
+	padding := strings.Repeat(" ", spaces)
+	return padding + strings.Replace(value, "\n", "\n"+padding, -1)
+}
+
+func nindent(spaces int, value string) string {
+	return "\n" + indent(spaces, value)
+}
+
+func toYaml(value interface{}) (string, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
 	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+func toJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+func b64enc(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+func b64dec(value string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	return string(data), err
+}
+
+func sha256sum(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func replace(old, new, value string) string {
+	return strings.Replace(value, old, new, -1)
 }
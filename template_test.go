@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+)
+
+func TestTemplateFunctions(t *testing.T) {
+	req := require.New(t)
+	config := &appConfig{}
+	project, err := readProject(nil, "test-assets/config-tests/templates", config)
+	req.NoError(err)
+	req.Equal("elrond", project.projectConfig.Namespace)
+	req.Len(project.services, 1)
+	configMap, ok := project.services[0].ResourceData.(*v1.ConfigMap)
+	req.True(ok)
+	req.Equal("app", configMap.Labels["app"])
+	req.Equal("backend", configMap.Labels["tier"])
+	req.Equal("2", configMap.Data["replicas"])
+	req.Equal("HELLO ARDA", configMap.Data["greeting"])
+	req.Equal("rivendell", configMap.Data["motd"])
+	req.Equal(sha256sum("rivendell"), configMap.Data["checksum"])
+}
+
+func TestProjectTemplateRootFolder(t *testing.T) {
+	req := require.New(t)
+	project, err := readProject(nil, "test-assets/config-tests/root-folder", &appConfig{})
+	req.NoError(err)
+	req.Equal("test-assets/config-tests/root-folder/app", project.projectConfig.RootFolder)
+	req.Equal("mithrandir", project.projectConfig.Variables["motd"])
+}
+
+func TestTemplateRequired(t *testing.T) {
+	req := require.New(t)
+	tmpl, err := newTemplate("test", `{{ index . "missing" | required "missing is required" }}`, ".", nil)
+	req.NoError(err)
+	err = tmpl.Execute(&bytes.Buffer{}, map[string]string{})
+	req.Error(err)
+	req.Contains(err.Error(), "missing is required")
+}
+
+func TestTemplateYaml(t *testing.T) {
+	req := require.New(t)
+	tmpl, err := newTemplate("test", `{{ toYaml . | indent 2 }}|{{ toJson . }}`, ".", nil)
+	req.NoError(err)
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, map[string]string{"a": "1", "b": "2"})
+	req.NoError(err)
+	req.Equal("  a: \"1\"\n  b: \"2\"|{\"a\":\"1\",\"b\":\"2\"}", buf.String())
+}
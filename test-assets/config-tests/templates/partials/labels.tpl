@@ -0,0 +1,4 @@
+{{- define "labels" -}}
+app: {{ . }}
+tier: backend
+{{- end -}}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
@@ -15,3 +16,14 @@ func translateFilePath(rootFolder, file string) string {
 	}
 	return filepath.Join(rootFolder, file)
 }
+
+var invalidLabelChars = regexp.MustCompile("[^a-zA-Z0-9_.-]+")
+
+// labelValue turns an arbitrary string into a valid kubernetes label value
+func labelValue(value string) string {
+	value = invalidLabelChars.ReplaceAllString(value, "-")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "-_.")
+}
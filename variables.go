@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// variableEnvPrefix marks the environment variables read as variables
+	variableEnvPrefix = "IMLADRIS_VAR_"
+	// maskedValue is printed in place of the variables read from encrypted files
+	maskedValue = "********"
+)
+
+// setVariable sets a project variable and remembers where its value came from
+func (p *Project) setVariable(key, value, source string) {
+	if p.projectConfig.Variables == nil {
+		p.projectConfig.Variables = make(map[string]string)
+	}
+	if p.variableSources == nil {
+		p.variableSources = make(map[string]string)
+	}
+	p.projectConfig.Variables[key] = value
+	p.variableSources[key] = source
+	delete(p.secretVariables, key)
+}
+
+// setSecretVariable sets a project variable whose value is never printed
+func (p *Project) setSecretVariable(key, value, source string) {
+	p.setVariable(key, value, source)
+	if p.secretVariables == nil {
+		p.secretVariables = make(map[string]struct{})
+	}
+	p.secretVariables[key] = struct{}{}
+}
+
+// readVariableFiles loads yaml files of variables, possibly encrypted, later
+// files override earlier ones
+func (p *Project) readVariableFiles(rootFolder string, filenames []string) error {
+	for _, filename := range filenames {
+		filename = translateFilePath(rootFolder, filename)
+		data, encrypted, err := readSecretFileState(filename)
+		if err != nil {
+			return err
+		}
+		variables := make(map[string]string)
+		err = yaml.Unmarshal(data, &variables)
+		if err != nil {
+			return fmt.Errorf("unable to read variable file %q: %s", filename, err.Error())
+		}
+		for key, value := range variables {
+			if encrypted {
+				p.setSecretVariable(key, value, "encrypted file "+filename)
+				continue
+			}
+			p.setVariable(key, value, "file "+filename)
+		}
+	}
+	return nil
+}
+
+// readEnvironmentVariables loads the IMLADRIS_VAR_<name> environment variables
+func (p *Project) readEnvironmentVariables() {
+	for _, env := range os.Environ() {
+		pieces := strings.SplitN(env, "=", 2)
+		if len(pieces) != 2 || !strings.HasPrefix(pieces[0], variableEnvPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(pieces[0], variableEnvPrefix)
+		if key == "" {
+			continue
+		}
+		p.setVariable(key, pieces[1], "environment variable "+pieces[0])
+	}
+}
+
+// PrintVariables shows the merged variables and the source of each one, the
+// values read from encrypted files are masked
+func (p *Project) PrintVariables() {
+	keys := []string{}
+	for key := range p.projectConfig.Variables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := p.projectConfig.Variables[key]
+		_, secret := p.secretVariables[key]
+		if secret {
+			value = maskedValue
+		}
+		Printf(ColorWhite, "%s = %q ", key, value)
+		Printf(ColorCyan, "(%s)\n", p.variableSources[key])
+	}
+}